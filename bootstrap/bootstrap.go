@@ -5,6 +5,7 @@ import (
 	"github.com/hollowdjj/course-selecting-sys/conf"
 	"github.com/hollowdjj/course-selecting-sys/models"
 	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/notify"
 	"github.com/hollowdjj/course-selecting-sys/proxy"
 )
 
@@ -16,6 +17,16 @@ func Run() {
 	logger.InitLogger("./log")
 
 	models.InitDb()
+	models.InitAuthenticator()
+
+	//jobs below notify students, so the sender is ready before them
+	notify.InitSender()
+
+	models.StartPurgeJob()
+	models.StartWaitlistJob()
+	models.StartBookingWorkers()
+	models.StartSeatEvents()
 
 	proxy.InitHttpPool()
+	proxy.StartEventRelay()
 }
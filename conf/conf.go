@@ -7,9 +7,10 @@ import (
 )
 
 type App struct {
-	RunMode  string
-	Host     string
-	MainHost string
+	RunMode     string
+	Host        string
+	MainHost    string
+	MaxPageSize int
 }
 
 type Logger struct {
@@ -31,12 +32,57 @@ type Db struct {
 	Name     string
 }
 
+type Notify struct {
+	Sender   string //log or file
+	FilePath string
+}
+
+type Ldap struct {
+	Enable         bool
+	Addr           string //ldap://host:389 or ldaps://host:636
+	UserDNTemplate string //such as uid=%s,ou=people,dc=example,dc=com
+	NicknameAttr   string
+	GroupAttr      string
+	AdminGroups    []string `delim:"|"`
+	TeacherGroups  []string `delim:"|"`
+	Timeout        int
+}
+
+type Retention struct {
+	UserDays      int //days a deleted user is kept before purged, 0 means never purge
+	PurgeInterval int //minutes between two purge runs
+}
+
+type Waitlist struct {
+	ClaimWindow    int //minutes a promoted student has to claim the seat
+	ExpireInterval int //seconds between two scans of expired promotions
+}
+
+type Booking struct {
+	Async     bool //book through the in-memory queue and worker pool instead of one transaction per request
+	QueueSize int  //bookings waiting to be written, more are refused as busy
+	Workers   int
+	BatchSize int //bookings written in one transaction
+	BatchWait int //milliseconds a worker waits for new bookings when the queue is empty
+	TicketTTL int //seconds a booking result is kept for polling
+}
+
+type Seats struct {
+	MaxRate int //remain_cap updates pushed per second per course at most
+}
+
 var (
-	config *ini.File
-	app    App
-	logger Logger
-	server Server
-	db     Db
+	config    *ini.File
+	app       App
+	logger    Logger
+	server    Server
+	db        Db
+	notify    Notify
+	ldap      Ldap
+	retention Retention
+	waitlist  Waitlist
+	booking   Booking
+	seats     Seats
 )
 
 //load config.ini
@@ -46,10 +92,16 @@ func LoadConfig(path string) {
 	if err != nil {
 		log.Fatalf("load config file [%s] error: %v", path, err)
 	}
-	mapTo("app", app)
-	mapTo("logger", logger)
-	mapTo("server", server)
-	mapTo("db", db)
+	mapTo("app", &app)
+	mapTo("logger", &logger)
+	mapTo("server", &server)
+	mapTo("db", &db)
+	mapTo("notify", &notify)
+	mapTo("ldap", &ldap)
+	mapTo("retention", &retention)
+	mapTo("waitlist", &waitlist)
+	mapTo("booking", &booking)
+	mapTo("seats", &seats)
 }
 
 //map .ini file's section to a go struct
@@ -79,3 +131,33 @@ func GetServer() Server {
 func GetDb() Db {
 	return db
 }
+
+//return a copy of conf.notify
+func GetNotify() Notify {
+	return notify
+}
+
+//return a copy of conf.ldap
+func GetLdap() Ldap {
+	return ldap
+}
+
+//return a copy of conf.retention
+func GetRetention() Retention {
+	return retention
+}
+
+//return a copy of conf.waitlist
+func GetWaitlist() Waitlist {
+	return waitlist
+}
+
+//return a copy of conf.booking
+func GetBooking() Booking {
+	return booking
+}
+
+//return a copy of conf.seats
+func GetSeats() Seats {
+	return seats
+}
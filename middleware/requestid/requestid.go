@@ -0,0 +1,24 @@
+package requestid
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
+)
+
+const (
+	//header used for passing request id between client, proxy and peers
+	Header = "X-Request-ID"
+	//key of the request id stored in gin context
+	Key = "request_id"
+)
+
+//a request id middleware. Reuse request id from header if exists, otherwise generate one
+func RequestID(c *gin.Context) {
+	id := c.GetHeader(Header)
+	if id == "" || len(id) > 64 {
+		id = utility.GenerateToken()
+	}
+	c.Set(Key, id)
+	c.Header(Header, id)
+	c.Next()
+}
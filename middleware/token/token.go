@@ -2,9 +2,10 @@ package middleware
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/hollowdjj/course-selecting-sys/cache"
+	"github.com/hollowdjj/course-selecting-sys/models"
 	"github.com/hollowdjj/course-selecting-sys/pkg/app"
 	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
 )
@@ -17,6 +18,19 @@ Gin中间件的作用有两个：
 为*gin.Context且没有返回值的函数
 */
 
+const (
+	//key of the login user info stored in gin context by Token
+	UserInfoKey = "user_info"
+	//key of the api key scopes stored in gin context by Token, only set when
+	//request is authorized by an api key
+	ScopesKey = "scopes"
+	//key of the scope declared by the route, stored in gin context by Scope
+	routeScopeKey = "route_scope"
+)
+
+//look up the owner and scopes of an api key, replaced in test
+var getUserInfoByApiKey = models.GetUserInfoByApiKey
+
 //a token middleware
 func Token(c *gin.Context) {
 	appG := app.Gin{C: c}
@@ -29,29 +43,81 @@ func Token(c *gin.Context) {
 		return
 	}
 
-	//find token in local cache
-	groupCacheLogin := cache.GetGroupCache("login")
-	if groupCacheLogin == nil {
-		appG.Response(http.StatusUnauthorized, constval.LoginRequired, nil)
-		c.Abort()
+	//api key for machine-to-machine access, only accepted by routes which declare a scope
+	if strings.HasPrefix(token, models.ApiKeyScheme) {
+		routeScope := c.GetString(routeScopeKey)
+		if routeScope == "" {
+			appG.Response(http.StatusForbidden, constval.PermDenied, nil)
+			c.Abort()
+			return
+		}
+		userInfo := &models.UserInfo{}
+		scopes := []string{}
+		httpCode, errCode := getUserInfoByApiKey(strings.TrimPrefix(token, models.ApiKeyScheme), userInfo, &scopes)
+		if errCode != constval.OK {
+			appG.Response(httpCode, errCode, nil)
+			c.Abort()
+			return
+		}
+		if !hasScope(scopes, routeScope) {
+			appG.Response(http.StatusForbidden, constval.PermDenied, nil)
+			c.Abort()
+			return
+		}
+		c.Set(UserInfoKey, userInfo)
+		c.Set(ScopesKey, scopes)
+		c.Next()
 		return
 	}
-	val, err := groupCacheLogin.Get(token, cache.Option{
-		FromLocal:  true,
-		FromPeer:   false,
-		FromGetter: false,
-	})
-	if err != nil {
-		appG.Response(http.StatusInternalServerError, constval.UnknownError, nil)
+
+	//find token in login cache or session table
+	userInfo := &models.UserInfo{}
+	httpCode, errCode := models.GetUserInfoByToken(token, userInfo)
+	if errCode != constval.OK {
+		appG.Response(httpCode, errCode, nil)
 		c.Abort()
 		return
 	}
-	if val.Len() == 0 {
+
+	//go next with login user info
+	c.Set(UserInfoKey, userInfo)
+	c.Next()
+}
+
+//an admin middleware, must be used after Token
+func Admin(c *gin.Context) {
+	appG := app.Gin{C: c}
+
+	userInfo, ok := c.Get(UserInfoKey)
+	if !ok {
 		appG.Response(http.StatusUnauthorized, constval.LoginRequired, nil)
 		c.Abort()
 		return
 	}
+	if models.UserType(userInfo.(*models.UserInfo).UserType) != models.Admin {
+		appG.Response(http.StatusForbidden, constval.PermDenied, nil)
+		c.Abort()
+		return
+	}
 
-	//go next if find token in local cache
 	c.Next()
 }
+
+//a scope middleware, must be used before Token. It declares the scope an api key must have to
+//access the route. Requests authorized by a login token are not restricted, and routes without a
+//scope refuse api keys
+func Scope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(routeScopeKey, scope)
+		c.Next()
+	}
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
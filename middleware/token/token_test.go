@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/models"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+)
+
+func TestApiKeyScope(t *testing.T) {
+	//an admin's key which may only create members
+	getUserInfoByApiKey = func(key string, userInfo *models.UserInfo, scopes *[]string) (int, constval.ErrNo) {
+		if key != "csk_member" {
+			return http.StatusUnauthorized, constval.LoginRequired
+		}
+		*userInfo = models.UserInfo{UserID: 1, UserType: int(models.Admin)}
+		*scopes = []string{"member:create"}
+		return http.StatusOK, constval.OK
+	}
+	defer func() { getUserInfoByApiKey = models.GetUserInfoByApiKey }()
+
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	g.POST("/member/create", Scope("member:create"), Token, Admin, ok)
+	g.POST("/course/create", Scope("course:create"), Token, Admin, ok)
+	g.POST("/auth/api_keys/create", Token, Admin, ok)
+	g.POST("/member/update", Token, ok)
+
+	cases := []struct {
+		path string
+		key  string
+		want int
+	}{
+		{"/member/create", "csk_member", http.StatusOK},
+		{"/member/create", "csk_unknown", http.StatusUnauthorized},
+		{"/course/create", "csk_member", http.StatusForbidden},
+		{"/auth/api_keys/create", "csk_member", http.StatusForbidden},
+		{"/member/update", "csk_member", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, c.path, nil)
+		req.Header.Set("Authorization", models.ApiKeyScheme+c.key)
+		g.ServeHTTP(w, req)
+		if w.Code != c.want {
+			t.Errorf("%s with key %s: want %d, got %d", c.path, c.key, c.want, w.Code)
+		}
+	}
+}
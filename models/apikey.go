@@ -0,0 +1,134 @@
+package models
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	//Authorization: ApiKey <key>
+	ApiKeyScheme = "ApiKey "
+	apiKeyPrefix = "csk_"
+)
+
+//scopes which can be granted to an api key
+var ApiKeyScopes = map[string]bool{
+	"member:create": true,
+	"course:create": true,
+}
+
+//used for minting an api key, admin only
+type CreateApiKeyForm struct {
+	Name      string   `json:"name" valid:"Required;MaxSize(64)"`
+	Scopes    []string `json:"scopes" valid:"Required"`
+	ExpiresIn int      `json:"expires_in" valid:"Min(0)"` //days, 0 means never expire
+}
+
+//mint an api key, the raw key is returned only once
+func (c *CreateApiKeyForm) CreateApiKey(ownerID uint64, rawKey *string, apiKey *ApiKey) (int, constval.ErrNo) {
+	for _, scope := range c.Scopes {
+		if !ApiKeyScopes[scope] {
+			logger.GetInstance().WithField("scope", scope).Infoln("unknown api key scope")
+			return http.StatusBadRequest, constval.ParamInvalid
+		}
+	}
+
+	key := apiKeyPrefix + utility.GenerateToken()
+	*apiKey = ApiKey{
+		Name:      c.Name,
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		KeyHash:   utility.HashToken(key),
+		Scopes:    strings.Join(c.Scopes, ","),
+		OwnerID:   ownerID,
+		CreatedAt: time.Now(),
+	}
+	if c.ExpiresIn > 0 {
+		expiredAt := apiKey.CreatedAt.AddDate(0, 0, c.ExpiresIn)
+		apiKey.ExpiredAt = &expiredAt
+	}
+	if err := Db.Create(apiKey).Error; err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"name": c.Name,
+			"err":  err,
+		}).Errorln("create api key error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	*rawKey = key
+	return http.StatusOK, constval.OK
+}
+
+//used for revoking an api key, admin only
+type RevokeApiKeyForm struct {
+	KeyID uint64 `json:"key_id" valid:"Required"`
+}
+
+func (r *RevokeApiKeyForm) RevokeApiKey() (int, constval.ErrNo) {
+	result := Db.Model(&ApiKey{}).Where("key_id = ? AND revoked_at IS NULL", r.KeyID).
+		Update("revoked_at", time.Now())
+	if err := result.Error; err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"key_id": r.KeyID,
+			"err":    err,
+		}).Errorln("revoke api key error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if result.RowsAffected == 0 {
+		return http.StatusBadRequest, constval.ApiKeyNotExist
+	}
+	return http.StatusOK, constval.OK
+}
+
+//list all api keys, including revoked and expired ones
+func GetApiKeys(apiKeys *[]ApiKey) (int, constval.ErrNo) {
+	err := Db.Order("key_id DESC").Find(apiKeys).Error
+	if err != nil {
+		logger.GetInstance().WithField("err", err).Errorln("query api keys error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	return http.StatusOK, constval.OK
+}
+
+//authenticate an api key. The key acts on behalf of the admin who minted it and
+//is restricted to its scopes
+func GetUserInfoByApiKey(key string, userInfo *UserInfo, scopes *[]string) (int, constval.ErrNo) {
+	apiKey := &ApiKey{}
+	now := time.Now()
+	result := Db.Where("key_hash = ? AND revoked_at IS NULL AND (expired_at IS NULL OR expired_at > ?)",
+		utility.HashToken(key), now).Limit(1).Find(apiKey)
+	if err := result.Error; err != nil {
+		logger.GetInstance().WithField("err", err).Errorln("query api key error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if result.RowsAffected == 0 {
+		return http.StatusUnauthorized, constval.LoginRequired
+	}
+
+	result = Db.Model(&User{}).Where("user_id = ? AND is_active = 1", apiKey.OwnerID).Limit(1).Find(userInfo)
+	if err := result.Error; err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"owner_id": apiKey.OwnerID,
+			"err":      err,
+		}).Errorln("query api key owner error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if result.RowsAffected == 0 {
+		//owner has been deactivated
+		return http.StatusUnauthorized, constval.LoginRequired
+	}
+
+	err := Db.Model(apiKey).Update("last_used_at", now).Error
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"key_id": apiKey.KeyID,
+			"err":    err,
+		}).Errorln("update api key last used time error")
+	}
+	*scopes = strings.Split(apiKey.Scopes, ",")
+	return http.StatusOK, constval.OK
+}
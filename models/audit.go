@@ -0,0 +1,126 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+//audit actions
+const (
+	AuditCreateUser     = "create_user"
+	AuditUpdateUser     = "update_user"
+	AuditDeleteUser     = "delete_user"
+	AuditRestoreUser    = "restore_user"
+	AuditPurgeUser      = "purge_user"
+	AuditUpdateCourse   = "update_course"
+	AuditDeleteCourse   = "delete_course"
+	AuditBindCourse     = "bind_course"
+	AuditUnBindCourse   = "unbind_course"
+	AuditBookCourse     = "book_course"
+	AuditDropCourse     = "drop_course"
+	AuditJoinWaitlist   = "join_waitlist"
+	AuditLeaveWaitlist  = "leave_waitlist"
+	AuditClaimWaitlist  = "claim_waitlist"
+	AuditSetSlots       = "set_course_slots"
+	AuditSetRequirement = "set_course_requirement"
+	AuditCreateTerm     = "create_term"
+	AuditOpenTerm       = "open_term"
+	AuditArchiveTerm    = "archive_term"
+	AuditCreatePhase    = "create_enrollment_phase"
+	AuditDeletePhase    = "delete_enrollment_phase"
+	AuditSetCreditLimit = "set_credit_limit"
+)
+
+//audit target types
+const (
+	AuditTargetUser   = "user"
+	AuditTargetCourse = "course"
+	AuditTargetTerm   = "term"
+)
+
+//who performs a mutation, used for writing audit log
+type Actor struct {
+	UserID    uint64
+	RequestID string
+	ClientIP  string
+}
+
+//write an audit log in tx. before and after are marshaled to json, nil means empty
+func writeAudit(tx *gorm.DB, actor Actor, action, targetType, targetID string, before, after interface{}) error {
+	auditLog := &AuditLog{
+		ActorID:    actor.UserID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		RequestID:  actor.RequestID,
+		ClientIP:   actor.ClientIP,
+		CreatedAt:  time.Now(),
+	}
+	for _, v := range []struct {
+		src interface{}
+		dst *string
+	}{{before, &auditLog.Before}, {after, &auditLog.After}} {
+		if v.src == nil {
+			continue
+		}
+		data, err := json.Marshal(v.src)
+		if err != nil {
+			return err
+		}
+		*v.dst = string(data)
+	}
+	return tx.Create(auditLog).Error
+}
+
+//used for querying audit log, admin only. StartTime and EndTime are unix timestamps
+type GetAuditLogForm struct {
+	ActorID    uint64 `form:"actor_id"`
+	Action     string `form:"action" valid:"MaxSize(64)"`
+	TargetType string `form:"target_type" valid:"MaxSize(32)"`
+	TargetID   string `form:"target_id" valid:"MaxSize(64)"`
+	StartTime  int64  `form:"start_time" valid:"Min(0)"`
+	EndTime    int64  `form:"end_time" valid:"Min(0)"`
+	Offset     int    `form:"offset" valid:"Min(0)"`
+	Limit      int    `form:"limit" valid:"Min(0)"` //0 means MaxPageSize, larger ones are clamped to it
+}
+
+func (g *GetAuditLogForm) GetAuditLogs(logs *[]AuditLog, total *int64) (int, constval.ErrNo) {
+	query := Db.Model(&AuditLog{})
+	if g.ActorID != 0 {
+		query = query.Where("actor_id = ?", g.ActorID)
+	}
+	if g.Action != "" {
+		query = query.Where("action = ?", g.Action)
+	}
+	if g.TargetType != "" {
+		query = query.Where("target_type = ?", g.TargetType)
+	}
+	if g.TargetID != "" {
+		query = query.Where("target_id = ?", g.TargetID)
+	}
+	if g.StartTime > 0 {
+		query = query.Where("created_at >= ?", time.Unix(g.StartTime, 0))
+	}
+	if g.EndTime > 0 {
+		query = query.Where("created_at < ?", time.Unix(g.EndTime, 0))
+	}
+
+	err := query.Count(total).Error
+	if err == nil {
+		err = query.Order("audit_id DESC").Offset(g.Offset).Limit(pageSize(g.Limit)).Find(logs).Error
+	}
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"form": *g,
+			"err":  err,
+		}).Errorln("query audit log error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	return http.StatusOK, constval.OK
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/astaxie/beego/validation"
+)
+
+func TestGetAuditLogFormLimit(t *testing.T) {
+	for _, tc := range []struct {
+		limit int
+		valid bool
+	}{{0, true}, {50, true}, {5000, true}, {-1, false}} {
+		valid := validation.Validation{}
+		ok, err := valid.Valid(&GetAuditLogForm{Limit: tc.limit})
+		if err != nil || ok != tc.valid {
+			t.Errorf("limit %d: want valid %v, got %v (%v)", tc.limit, tc.valid, ok, err)
+		}
+	}
+	if size := pageSize(0); size != defaultMaxPageSize {
+		t.Errorf("want limit 0 defaulted to %d, got %d", defaultMaxPageSize, size)
+	}
+}
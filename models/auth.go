@@ -23,51 +23,64 @@ type LoginForm struct {
 	Password string `form:"password" valid:"Required;MinSize(8);MaxSize(20)"`
 }
 
-//query db to check if username and password match
-func (l LoginForm) Login(tok *string) (int, constval.ErrNo) {
-	groupCacheLogin := cache.GetGroupCache("login")
-	if groupCacheLogin == nil {
-		groupCacheLogin = cache.NewGroupCache("login", loginCacheMaxBytes, cache.GetterFunc(UserInfoGetter))
+//check username and password by the authenticator in use and create a session
+func (l LoginForm) Login(tok *string, clientIP, userAgent string) (int, constval.ErrNo) {
+	userInfo := UserInfo{}
+	httpCode, errCode := GetAuthenticator().Authenticate(l.Username, l.Password, &userInfo)
+	if errCode != constval.OK {
+		return httpCode, errCode
 	}
-	_, err := groupCacheLogin.Get(l.Username, cache.Option{
-		FromLocal:  true,
-		FromPeer:   false,
-		FromGetter: true,
-		TTL:        loginCacheTTL,
-	})
+
+	//login succ, generate token and add cache
+	token, err := CreateSession(userInfo, clientIP, userAgent)
 	if err != nil {
 		logger.GetInstance().WithFields(logrus.Fields{
 			"username": l.Username,
 			"err":      err,
-		}).Errorln("user login error")
+		}).Errorln("create session error")
+		return http.StatusInternalServerError, constval.UnknownError
 	}
-
-	//login succ, generate token and add cache
-	token := utility.GenerateToken()
-	groupCacheLogin.Add(token, []byte(l.Username), loginCacheTTL)
-	tok = &token
+	*tok = token
 	return http.StatusOK, constval.OK
 }
 
-//judge is user is admin according to token
-func IsAdmin(token string) (int, constval.ErrNo) {
-	groupCacheToken := cache.GetGroupCache("login")
-	if groupCacheToken == nil {
-		return http.StatusBadRequest, constval.LoginRequired
+//get the user who owns the token. Sessions are cached in group session by token hash, apart from
+//users cached in group login by username, so a username is never taken as a token
+func GetUserInfoByToken(token string, userInfo *UserInfo) (int, constval.ErrNo) {
+	if token == "" {
+		return http.StatusUnauthorized, constval.LoginRequired
+	}
+	tokenHash := utility.HashToken(token)
+	groupCacheSession := cache.GetGroupCache("session")
+	if groupCacheSession == nil {
+		groupCacheSession = cache.NewGroupCache("session", loginCacheMaxBytes, cache.GetterFunc(SessionGetter))
 	}
-	val, _ := groupCacheToken.Get(token, cache.Option{
+	val, _ := groupCacheSession.Get(tokenHash, cache.Option{
 		FromLocal:  true,
 		FromPeer:   false,
 		FromGetter: false,
 	})
 	if val.Len() == 0 {
-		return http.StatusUnauthorized, constval.LoginRequired
+		//token may be issued by another node or before restart, fall back to session table
+		return getUserInfoBySession(tokenHash, userInfo)
 	}
-	userinfo := &UserInfo{}
-	err := json.Unmarshal(val.ByteSlice(), userinfo)
+	err := json.Unmarshal(val.ByteSlice(), userInfo)
 	if err != nil {
 		logger.GetInstance().WithField("err", err).Errorln("json unmarshal fail")
 		return http.StatusInternalServerError, constval.UnknownError
 	}
 	return http.StatusOK, constval.OK
 }
+
+//judge is user is admin according to token
+func IsAdmin(token string) (int, constval.ErrNo) {
+	userInfo := &UserInfo{}
+	httpCode, errCode := GetUserInfoByToken(token, userInfo)
+	if errCode != constval.OK {
+		return httpCode, errCode
+	}
+	if UserType(userInfo.UserType) != Admin {
+		return http.StatusForbidden, constval.PermDenied
+	}
+	return http.StatusOK, constval.OK
+}
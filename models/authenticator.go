@@ -0,0 +1,182 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/cache"
+	"github.com/hollowdjj/course-selecting-sys/conf"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/ldapauth"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+//Authenticator checks username and password and fills in the local user info
+type Authenticator interface {
+	Authenticate(username, password string, userInfo *UserInfo) (int, constval.ErrNo)
+}
+
+var authenticator Authenticator = DbAuthenticator{}
+
+//Init authenticator according to conf.ldap
+func InitAuthenticator() {
+	ldapConf := conf.GetLdap()
+	if !ldapConf.Enable {
+		authenticator = DbAuthenticator{}
+		return
+	}
+	authenticator = LdapAuthenticator{
+		Config: ldapauth.Config{
+			Addr:           ldapConf.Addr,
+			UserDNTemplate: ldapConf.UserDNTemplate,
+			NicknameAttr:   ldapConf.NicknameAttr,
+			GroupAttr:      ldapConf.GroupAttr,
+			Timeout:        time.Duration(ldapConf.Timeout) * time.Second,
+		},
+		AdminGroups:   ldapConf.AdminGroups,
+		TeacherGroups: ldapConf.TeacherGroups,
+	}
+}
+
+//Get the authenticator in use
+func GetAuthenticator() Authenticator {
+	return authenticator
+}
+
+//DbAuthenticator checks password stored in table user
+type DbAuthenticator struct{}
+
+func (DbAuthenticator) Authenticate(username, password string, userInfo *UserInfo) (int, constval.ErrNo) {
+	groupCacheLogin := cache.GetGroupCache("login")
+	if groupCacheLogin == nil {
+		groupCacheLogin = cache.NewGroupCache("login", loginCacheMaxBytes, cache.GetterFunc(UserInfoGetter))
+	}
+	val, err := groupCacheLogin.Get(username, cache.Option{
+		FromLocal:  true,
+		FromPeer:   false,
+		FromGetter: true,
+		TTL:        loginCacheTTL,
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"username": username,
+			"err":      err,
+		}).Errorln("user login error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if val.Len() == 0 {
+		return http.StatusBadRequest, constval.UserNotExist
+	}
+
+	//check user state and password
+	user := &User{}
+	err = json.Unmarshal(val.ByteSlice(), user)
+	if err != nil {
+		groupCacheLogin.Del(username)
+		logger.GetInstance().WithField("err", err).Errorln("json unmarshal user fail")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if user.IsActive == 0 {
+		return http.StatusBadRequest, constval.UserDeleted
+	}
+	if user.Password != password {
+		return http.StatusBadRequest, constval.WrongPassword
+	}
+
+	*userInfo = user.Info()
+	return http.StatusOK, constval.OK
+}
+
+//LdapAuthenticator binds to an ldap directory as the user. The local user row is
+//provisioned on first login and its user type follows directory groups. Users created
+//locally are refused, so that a directory entry can not take over a local account
+type LdapAuthenticator struct {
+	Config        ldapauth.Config
+	AdminGroups   []string
+	TeacherGroups []string
+}
+
+func (l LdapAuthenticator) Authenticate(username, password string, userInfo *UserInfo) (int, constval.ErrNo) {
+	entry := ldapauth.Entry{}
+	err := ldapauth.Bind(l.Config, username, password, &entry)
+	if err == ldapauth.ErrInvalidCredentials {
+		return http.StatusBadRequest, constval.WrongPassword
+	}
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"username": username,
+			"err":      err,
+		}).Errorln("ldap bind error")
+		return http.StatusBadGateway, constval.UnknownError
+	}
+
+	//just-in-time provisioning, password is never stored locally
+	user := &User{}
+	userType := l.userType(entry.Groups)
+	nickname := entry.Nickname
+	if nickname == "" {
+		nickname = username
+	}
+	result := Db.Where("username = ?", username).Limit(1).Find(user)
+	if err := result.Error; err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"username": username,
+			"err":      err,
+		}).Errorln("query ldap user error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if result.RowsAffected == 0 {
+		user = &User{Username: username, Nickname: nickname, UserType: int(userType), IsActive: 1,
+			AuthSource: AuthSourceLdap}
+		err = Db.Create(user).Error
+	} else if user.AuthSource != AuthSourceLdap {
+		//a local account with the same username, linking it would hand it to the directory user
+		logger.GetInstance().WithFields(logrus.Fields{
+			"username":    username,
+			"auth_source": user.AuthSource,
+		}).Warnln("ldap login of a local user")
+		return http.StatusForbidden, constval.NotDirectoryUser
+	} else if user.UserType != int(userType) || user.Nickname != nickname {
+		user.UserType, user.Nickname = int(userType), nickname
+		err = Db.Model(user).Select("user_type", "nickname").Updates(user).Error
+		invalidateUserCache(strconv.FormatUint(user.UserID, 10))
+	}
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"username": username,
+			"err":      err,
+		}).Errorln("provision ldap user error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if user.IsActive == 0 {
+		return http.StatusBadRequest, constval.UserDeleted
+	}
+
+	*userInfo = user.Info()
+	return http.StatusOK, constval.OK
+}
+
+//map directory groups to user type, admin takes precedence over teacher
+func (l LdapAuthenticator) userType(groups []string) UserType {
+	in := func(targets []string) bool {
+		for _, g := range groups {
+			for _, t := range targets {
+				if g == t {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	switch {
+	case in(l.AdminGroups):
+		return Admin
+	case in(l.TeacherGroups):
+		return Teacher
+	default:
+		return Student
+	}
+}
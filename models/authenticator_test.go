@@ -0,0 +1,111 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/ldapauth"
+	"github.com/hollowdjj/course-selecting-sys/pkg/ldapauth/ldaptest"
+)
+
+const (
+	testAdminGroup   = "cn=admins,ou=groups,dc=example,dc=com"
+	testTeacherGroup = "cn=teachers,ou=groups,dc=example,dc=com"
+)
+
+func newTestLdapAuthenticator(t *testing.T, users map[string]ldaptest.User) LdapAuthenticator {
+	s := ldaptest.NewServer(t, users)
+	return LdapAuthenticator{
+		Config: ldapauth.Config{
+			Addr:           s.Addr(),
+			UserDNTemplate: "uid=%s,ou=people,dc=example,dc=com",
+			NicknameAttr:   "displayName",
+			GroupAttr:      "memberOf",
+			Timeout:        3 * time.Second,
+		},
+		AdminGroups:   []string{testAdminGroup},
+		TeacherGroups: []string{testTeacherGroup},
+	}
+}
+
+func TestLdapUserType(t *testing.T) {
+	l := LdapAuthenticator{AdminGroups: []string{testAdminGroup}, TeacherGroups: []string{testTeacherGroup}}
+	for _, tc := range []struct {
+		groups []string
+		want   UserType
+	}{
+		{nil, Student},
+		{[]string{"cn=others,ou=groups,dc=example,dc=com"}, Student},
+		{[]string{testTeacherGroup}, Teacher},
+		{[]string{testAdminGroup}, Admin},
+		{[]string{testTeacherGroup, testAdminGroup}, Admin},
+	} {
+		if got := l.userType(tc.groups); got != tc.want {
+			t.Errorf("groups %v: want user type %d, got %d", tc.groups, tc.want, got)
+		}
+	}
+}
+
+func TestLdapAuthenticate(t *testing.T) {
+	setupBookingDb(t)
+	username := fmt.Sprintf("l%d", time.Now().UnixNano())
+	dn := fmt.Sprintf("uid=%s,ou=people,dc=example,dc=com", username)
+	l := newTestLdapAuthenticator(t, map[string]ldaptest.User{
+		dn: {Password: "Passw0rd", Nickname: "Zhang San", Groups: []string{testTeacherGroup}},
+	})
+
+	//provisioned on first login
+	userInfo := &UserInfo{}
+	if _, errCode := l.Authenticate(username, "Passw0rd", userInfo); errCode != constval.OK {
+		t.Fatalf("first ldap login fail: %s", constval.GetErrCodeMsg(errCode))
+	}
+	user := &User{}
+	if err := Db.Where("username = ?", username).First(user).Error; err != nil {
+		t.Fatalf("query provisioned user error: %v", err)
+	}
+	if user.AuthSource != AuthSourceLdap || user.UserType != int(Teacher) || user.Nickname != "Zhang San" ||
+		user.Password != "" {
+		t.Errorf("unexpected provisioned user %+v", user)
+	}
+	if _, errCode := l.Authenticate(username, "wrong", userInfo); errCode != constval.WrongPassword {
+		t.Errorf("want wrong password refused, got %s", constval.GetErrCodeMsg(errCode))
+	}
+
+	//user type follows the groups on later logins
+	l = newTestLdapAuthenticator(t, map[string]ldaptest.User{
+		dn: {Password: "Passw0rd", Nickname: "Zhang San", Groups: []string{testAdminGroup}},
+	})
+	if _, errCode := l.Authenticate(username, "Passw0rd", userInfo); errCode != constval.OK {
+		t.Fatalf("second ldap login fail: %s", constval.GetErrCodeMsg(errCode))
+	}
+	if userInfo.UserID != user.UserID || userInfo.UserType != int(Admin) {
+		t.Errorf("want user %d promoted to admin, got %+v", user.UserID, userInfo)
+	}
+}
+
+func TestLdapAuthenticateLocalUser(t *testing.T) {
+	setupBookingDb(t)
+	local := &User{Username: fmt.Sprintf("l%d", time.Now().UnixNano()), Password: "local", UserType: int(Student)}
+	if err := Db.Create(local).Error; err != nil {
+		t.Fatalf("create local user error: %v", err)
+	}
+	l := newTestLdapAuthenticator(t, map[string]ldaptest.User{
+		fmt.Sprintf("uid=%s,ou=people,dc=example,dc=com", local.Username): {
+			Password: "Passw0rd",
+			Groups:   []string{testAdminGroup},
+		},
+	})
+
+	if _, errCode := l.Authenticate(local.Username, "Passw0rd", &UserInfo{}); errCode != constval.NotDirectoryUser {
+		t.Fatalf("want local user refused, got %s", constval.GetErrCodeMsg(errCode))
+	}
+	user := &User{}
+	if err := Db.First(user, local.UserID).Error; err != nil {
+		t.Fatalf("query local user error: %v", err)
+	}
+	if user.UserType != int(Student) || user.AuthSource != AuthSourceLocal {
+		t.Errorf("want local user untouched, got %+v", user)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hollowdjj/course-selecting-sys/cache"
 	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
@@ -28,14 +29,85 @@ type BookCourseForm struct {
 	CourseID string `valid:"Required;Numeric"`
 }
 
-func (b BookCourseForm) BookCourse() (int, constval.ErrNo) {
+//extra result of booking which is returned to the client
+type BookResult struct {
+	NextOpenAt *int64 `json:"next_open_at,omitempty"` //unix timestamp, set when enrollment is closed for the student
+	//the booked course which meets at the same time
+	ConflictCourseID   uint64 `json:"conflict_course_id,omitempty"`
+	ConflictCourseName string `json:"conflict_course_name,omitempty"`
+	//set when the student does not meet requirements of the course
+	Requirement *Eligibility `json:"requirement,omitempty"`
+	MaxCredits  uint         `json:"max_credits,omitempty"` //set when the credit limit is exceeded
+}
+
+//what booking a course needs after the checks which lock nothing
+type bookPlan struct {
+	course     *Course
+	maxCredits uint //0 means no limit
+}
+
+func (b BookCourseForm) BookCourse(actor Actor, bookResult *BookResult) (int, constval.ErrNo) {
+	plan := bookPlan{}
+	if httpCode, errCode := b.plan(bookResult, &plan); errCode != constval.OK {
+		return httpCode, errCode
+	}
+
+	//take a seat from the cached remain_cap
+	ok, err := takeSeat(b.CourseID)
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid":   b.UserID,
+			"courseid": b.CourseID,
+			"err":      err,
+		}).Errorln("get course remain cap err")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if !ok {
+		return http.StatusOK, constval.CourseNotAvailable
+	}
+
+	//book course and update cache
+	rejected := constval.OK
+	err = Db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		rejected, err = b.book(tx, actor, &plan, bookResult)
+		return err
+	})
+	if isDuplicateKey(err) {
+		returnSeat(b.CourseID)
+		return http.StatusOK, constval.StudentHasCourse
+	}
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"course_id": b.CourseID,
+			"err":       err,
+		}).Errorln("book course error")
+		returnSeat(b.CourseID)
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	switch rejected {
+	case constval.OK:
+		invalidateStudentCourseCache(b.UserID, b.CourseID)
+		seatsChanged(b.CourseID)
+		return http.StatusOK, constval.OK
+	case constval.CourseNotAvailable:
+		//suggest that course has no cap and cache is not up to date
+		resetSeat(b.CourseID)
+		return http.StatusOK, constval.CourseNotAvailable
+	}
+	returnSeat(b.CourseID)
+	return http.StatusBadRequest, rejected
+}
+
+//checks before taking a seat. The student must not have booked the course and must pass
+//precheck. The credit limit of the booking is worked out too
+func (b BookCourseForm) plan(bookResult *BookResult, plan *bookPlan) (int, constval.ErrNo) {
 	//check whether student has this course
 	studentCourseCache := cache.GetGroupCache("student_course")
 	if studentCourseCache == nil {
 		studentCourseCache = cache.NewGroupCache("student_course", maxStudentCourseBytes, cache.GetterFunc(StudentCourseGetter))
 	}
-	key := b.UserID + "_" + b.CourseID
-	val, err := studentCourseCache.Get(key, cache.DefaultOption)
+	val, err := studentCourseCache.Get(b.UserID+"_"+b.CourseID, cache.DefaultOption)
 	if err != nil {
 		logger.GetInstance().WithFields(logrus.Fields{
 			"form": b,
@@ -46,59 +118,213 @@ func (b BookCourseForm) BookCourse() (int, constval.ErrNo) {
 		return http.StatusOK, constval.StudentHasCourse
 	}
 
-	//get course remain cap and judge
-	courseRemainCapCache := cache.GetGroupCache("course_remain_cap")
-	if courseRemainCapCache == nil {
-		courseRemainCapCache = cache.NewGroupCache("course_remain_cap", maxCourseRemainCapBytes, cache.GetterFunc(CourseRemainCapGetter))
+	course := &Course{}
+	if httpCode, errCode := (GetCourseForm{CourseID: b.CourseID}).GetCourseInfo(course); errCode != constval.OK {
+		return httpCode, errCode
 	}
-	val, err = courseRemainCapCache.Get(b.CourseID, cache.DefaultOption)
-	if err != nil {
+	phase := EnrollmentPhase{}
+	if httpCode, errCode := b.precheck(course, &phase, bookResult); errCode != constval.OK {
+		return httpCode, errCode
+	}
+
+	//the tighter one of the student's limit and the phase's limit
+	limit := CreditLimit{}
+	if err := creditLimitOf(Db, b.UserID, course.TermID, &limit); err != nil {
 		logger.GetInstance().WithFields(logrus.Fields{
-			"userid":   b.UserID,
-			"courseid": b.CourseID,
-			"err":      err,
-		}).Errorln("get course remain cap err")
+			"userid": b.UserID,
+			"err":    err,
+		}).Errorln("get credit limit error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	maxCredits := limit.MaxCredits
+	if phase.MaxCredits > 0 && (maxCredits == 0 || uint(phase.MaxCredits) < maxCredits) {
+		maxCredits = uint(phase.MaxCredits)
+	}
+	*plan = bookPlan{course: course, maxCredits: maxCredits}
+	return http.StatusOK, constval.OK
+}
+
+//take a seat of the course and insert the enrollment in tx. The student is locked first so
+//that sections, time conflicts and credits of concurrent bookings are checked one by one.
+//Return the reason if the booking is rejected, details are put into result. A duplicate key
+//error means the student has booked the course
+func (b BookCourseForm) book(tx *gorm.DB, actor Actor, plan *bookPlan, bookResult *BookResult) (constval.ErrNo, error) {
+	course := plan.course
+	if err := lockStudent(tx, b.UserID); err != nil {
+		return constval.UnknownError, err
+	}
+	other, err := hasOtherSection(tx, b.UserID, course)
+	if err != nil {
+		return constval.UnknownError, err
+	}
+	if other {
+		return constval.SectionConflict, nil
+	}
+	conflict, err := conflictingCourse(tx, b.UserID, course)
+	if err != nil {
+		return constval.UnknownError, err
+	}
+	if conflict != nil {
+		bookResult.ConflictCourseID = conflict.CourseID
+		bookResult.ConflictCourseName = conflict.CourseName
+		return constval.CourseTimeConflict, nil
+	}
+	if plan.maxCredits > 0 {
+		exceeded, err := exceedsCredits(tx, b.UserID, course.TermID, course.Credits, plan.maxCredits)
+		if err != nil {
+			return constval.UnknownError, err
+		}
+		if exceeded {
+			bookResult.MaxCredits = plan.maxCredits
+			return constval.CreditLimitExceeded, nil
+		}
+	}
+	result := tx.Model(&Course{}).Where("course_id = ? AND remain_cap > 0", course.CourseID).
+		Update("remain_cap", gorm.Expr("remain_cap - ?", 1))
+	if result.Error != nil {
+		return constval.UnknownError, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return constval.CourseNotAvailable, nil
+	}
+	//a concurrent booking of the same course fails on the unique index and rolls back
+	studentID, _ := strconv.ParseUint(b.UserID, 10, 64)
+	err = tx.Create(&StudentCourse{StudentID: studentID, CourseID: course.CourseID, TermID: course.TermID}).Error
+	if err != nil {
+		return constval.UnknownError, err
+	}
+	err = writeAudit(tx, actor, AuditBookCourse, AuditTargetCourse, b.CourseID,
+		nil, map[string]interface{}{"student_id": b.UserID})
+	if err != nil {
+		return constval.UnknownError, err
+	}
+	return constval.OK, nil
+}
+
+//checks before booking or waiting for a course: the course must be in the current term and
+//the student must be in an enrollment phase, meet requirements, hold no other section of the
+//catalog course and have no time conflict
+func (b BookCourseForm) precheck(course *Course, phase *EnrollmentPhase, bookResult *BookResult) (int, constval.ErrNo) {
+	termID, err := currentTermID()
+	if err != nil {
+		logger.GetInstance().WithField("err", err).Errorln("get current term error")
 		return http.StatusInternalServerError, constval.UnknownError
 	}
-	remainCap, err := strconv.Atoi(string(val.ByteSlice()))
+	if termID == 0 || course.TermID != termID {
+		return http.StatusBadRequest, constval.CourseNotInCurrentTerm
+	}
+	if httpCode, errCode := b.checkPhase(termID, time.Now(), phase, bookResult); errCode != constval.OK {
+		return httpCode, errCode
+	}
+	eligibility := Eligibility{}
+	if httpCode, errCode := checkRequirement(b.UserID, course, &eligibility); errCode != constval.OK {
+		return httpCode, errCode
+	}
+	if !eligibility.Eligible {
+		bookResult.Requirement = &eligibility
+		return http.StatusBadRequest, constval.RequirementNotMet
+	}
+	other, err := hasOtherSection(Db, b.UserID, course)
 	if err != nil {
 		logger.GetInstance().WithFields(logrus.Fields{
-			"data": val.ByteSlice(),
+			"form": b,
 			"err":  err,
-		}).Errorln("convert course remain_cap to int error")
+		}).Errorln("query booked sections error")
 		return http.StatusInternalServerError, constval.UnknownError
 	}
-	if remainCap <= 0 {
-		return http.StatusOK, constval.CourseNotAvailable
+	if other {
+		return http.StatusBadRequest, constval.SectionConflict
 	}
+	return b.checkConflict(course, bookResult)
+}
 
-	//book course and update cache
-	remainCap--
-	courseRemainCapCache.Add(key, []byte(strconv.Itoa(remainCap)), 60)
-	result := Db.Model(&Course{}).Where("course_id = ? AND remain_cap > 0", b.CourseID).
-		Update("remain_cap", gorm.Expr("remain_cap - ?", 1))
-	if result.Error != nil {
+//used for dropping a booked course
+type DropCourseForm struct {
+	UserID   string `valid:"Required;Numeric"`
+	CourseID string `valid:"Required;Numeric"`
+}
+
+//delete the enrollment and give the seat back in one transaction
+func (d DropCourseForm) DropCourse(actor Actor) (int, constval.ErrNo) {
+	course := &Course{}
+	if httpCode, errCode := (GetCourseForm{CourseID: d.CourseID}).GetCourseInfo(course); errCode != constval.OK {
+		return httpCode, errCode
+	}
+	term := &Term{}
+	err := Db.Select("status", "drop_deadline").Where("term_id = ?", course.TermID).Limit(1).Find(term).Error
+	if err != nil {
 		logger.GetInstance().WithFields(logrus.Fields{
-			"course_id": b.CourseID,
+			"term_id": course.TermID,
+			"err":     err,
+		}).Errorln("query term error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if term.Status != TermOpen {
+		return http.StatusBadRequest, constval.CourseNotInCurrentTerm
+	}
+	if term.DropDeadline != nil && time.Now().After(*term.DropDeadline) {
+		return http.StatusBadRequest, constval.DropDeadlinePassed
+	}
+
+	var (
+		dropped  int64
+		promoted *Waitlist
+	)
+	err = Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("student_id = ? AND course_id = ?", d.UserID, d.CourseID).Delete(&StudentCourse{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		dropped = result.RowsAffected
+		var err error
+		if promoted, err = releaseSeat(tx, course.CourseID); err != nil {
+			return err
+		}
+		return writeAudit(tx, actor, AuditDropCourse, AuditTargetCourse, d.CourseID,
+			map[string]interface{}{"student_id": d.UserID}, nil)
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id":   d.UserID,
+			"course_id": d.CourseID,
 			"err":       err,
-		}).Errorln("update course remain_cap error")
-		courseRemainCapCache.Add(key, []byte(strconv.Itoa(remainCap+1)), 60)
+		}).Errorln("drop course error")
 		return http.StatusInternalServerError, constval.UnknownError
 	}
-	httpCode, errCode := http.StatusOK, constval.OK
-	if result.RowsAffected == 0 {
-		//suggest that course has no cap and cache is not up to date
-		remainCap = 0
-		httpCode, errCode = http.StatusOK, constval.CourseNotAvailable
-		courseRemainCapCache.Add(key, []byte("0"), 60)
+	if dropped == 0 {
+		return http.StatusBadRequest, constval.CourseNotBooked
+	}
+	invalidateEnrollmentCache(d.UserID, d.CourseID)
+	notifyPromoted(promoted)
+	return http.StatusOK, constval.OK
+}
+
+//drop cached enrollment of a student and remain cap of a course after the enrollment changes
+func invalidateEnrollmentCache(studentID, courseID string) {
+	invalidateStudentCourseCache(studentID, courseID)
+	invalidateSeatCache(courseID)
+}
+
+//drop cached course list of a student and whether the student has the course
+func invalidateStudentCourseCache(studentID, courseID string) {
+	if studentCourseCache := cache.GetGroupCache("student_course"); studentCourseCache != nil {
+		studentCourseCache.Del(studentID)
+		studentCourseCache.Del(studentID + "_" + courseID)
 	}
+}
 
-	return httpCode, errCode
+//drop cached remain_cap and info of a course whose seats are changed
+func invalidateSeatCache(courseID string) {
+	if courseRemainCapCache := cache.GetGroupCache("course_remain_cap"); courseRemainCapCache != nil {
+		courseRemainCapCache.Del(courseID)
+	}
+	invalidateCourseCache(courseID)
+	seatsChanged(courseID)
 }
 
 //used for quering student course
 type GetStudentCourseForm struct {
-	UserID string `valid:"Required;Numeric"`
+	UserID string `form:"user_id" valid:"Required;Numeric"`
 }
 
 func (g GetStudentCourseForm) GetStudentCourse(courses *[]Course) (int, constval.ErrNo) {
@@ -114,6 +340,9 @@ func (g GetStudentCourseForm) GetStudentCourse(courses *[]Course) (int, constval
 		}).Errorln("get student courses error")
 		return http.StatusInternalServerError, constval.UnknownError
 	}
+	if val.Len() == 0 {
+		return http.StatusOK, constval.OK
+	}
 
 	courseInfoCache := cache.GetGroupCache("course_info")
 	if courseInfoCache == nil {
@@ -140,3 +369,19 @@ func (g GetStudentCourseForm) GetStudentCourse(courses *[]Course) (int, constval
 	}
 	return http.StatusOK, constval.OK
 }
+
+//credit load of the student in the current term
+func (g GetStudentCourseForm) GetCreditLimit(limit *CreditLimit) (int, constval.ErrNo) {
+	termID, httpCode, errCode := resolveTermID(0)
+	if errCode != constval.OK {
+		return httpCode, errCode
+	}
+	if err := creditLimitOf(Db, g.UserID, termID, limit); err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": g.UserID,
+			"err":     err,
+		}).Errorln("get credit limit error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	return http.StatusOK, constval.OK
+}
@@ -0,0 +1,266 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/timetable"
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+//booking tests run against a real MySQL database and are skipped unless TEST_MYSQL_DSN is set, e.g.
+//TEST_MYSQL_DSN="root:123456@tcp(127.0.0.1:3306)/course_test?charset=utf8mb4&parseTime=True&loc=Local"
+//Tables of the database are dropped and created again.
+var (
+	bookingDbOnce sync.Once
+	bookingDbErr  error
+	bookingTerm   = &Term{}
+)
+
+func setupBookingDb(t *testing.T) {
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN is not set")
+	}
+	bookingDbOnce.Do(func() {
+		logger.InitLogger(filepath.Join(os.TempDir(), "course-selecting-sys-test.log"))
+		Db, bookingDbErr = gorm.Open(mysql.Open(dsn), &gorm.Config{
+			NamingStrategy:                           schema.NamingStrategy{SingularTable: true},
+			DisableForeignKeyConstraintWhenMigrating: true,
+			Logger:                                   gormlogger.Discard,
+		})
+		if bookingDbErr != nil {
+			return
+		}
+		tables := []interface{}{&User{}, &Course{}, &StudentCourse{}, &Session{}, &PasswordReset{}, &ApiKey{},
+			&AuditLog{}, &Profile{}, &Term{}, &EnrollmentPhase{}, &CourseSlot{}, &CourseRequirement{},
+			&CreditLimit{}, &Waitlist{}, &CatalogCourse{}}
+		if bookingDbErr = Db.Migrator().DropTable(tables...); bookingDbErr != nil {
+			return
+		}
+		//the initial tables are created outside of the server
+		if bookingDbErr = Db.AutoMigrate(&User{}, &Course{}, &StudentCourse{}); bookingDbErr != nil {
+			return
+		}
+		migrate()
+
+		now := time.Now()
+		*bookingTerm = Term{Name: "booking test", StartDate: now, EndDate: now.AddDate(0, 4, 0), Status: TermOpen}
+		bookingDbErr = Db.Create(bookingTerm).Error
+	})
+	if bookingDbErr != nil {
+		t.Fatalf("setup booking database error: %v", bookingDbErr)
+	}
+}
+
+//a new course of the open term, so that cached data of other tests is not hit
+func newTestCourse(t *testing.T, seats uint) *Course {
+	code := fmt.Sprintf("T%d", time.Now().UnixNano())
+	catalog := &CatalogCourse{CourseName: code, Code: code}
+	if err := Db.Create(catalog).Error; err != nil {
+		t.Fatalf("create catalog course error: %v", err)
+	}
+	course := &Course{CatalogID: catalog.CatalogID, CourseName: code, Code: code, Cap: seats, RemainCap: seats,
+		TermID: bookingTerm.TermID}
+	if err := Db.Create(course).Error; err != nil {
+		t.Fatalf("create course error: %v", err)
+	}
+	return course
+}
+
+func newTestStudents(t *testing.T, n int) []string {
+	ids := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		user := &User{Username: fmt.Sprintf("s%d_%d", time.Now().UnixNano(), i), UserType: int(Student)}
+		if err := Db.Create(user).Error; err != nil {
+			t.Fatalf("create student error: %v", err)
+		}
+		ids = append(ids, strconv.FormatUint(user.UserID, 10))
+	}
+	return ids
+}
+
+//book concurrently, one booking per student id, and return the error codes
+func bookConcurrently(course *Course, studentIDs []string) []constval.ErrNo {
+	courseID := strconv.FormatUint(course.CourseID, 10)
+	errCodes := make([]constval.ErrNo, len(studentIDs))
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i, id := range studentIDs {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			<-start
+			_, errCodes[i] = BookCourseForm{UserID: id, CourseID: courseID}.BookCourse(Actor{}, &BookResult{})
+		}(i, id)
+	}
+	close(start)
+	wg.Wait()
+	return errCodes
+}
+
+//number of enrollments and remain_cap of the course in database
+func enrollmentOf(t *testing.T, course *Course) (int64, uint) {
+	var enrolled int64
+	err := Db.Model(&StudentCourse{}).Where("course_id = ?", course.CourseID).Count(&enrolled).Error
+	if err == nil {
+		err = Db.Where("course_id = ?", course.CourseID).First(course).Error
+	}
+	if err != nil {
+		t.Fatalf("query enrollment error: %v", err)
+	}
+	return enrolled, course.RemainCap
+}
+
+func TestBookCourseNoOversell(t *testing.T) {
+	setupBookingDb(t)
+	const seats, students = 5, 50
+	course := newTestCourse(t, seats)
+
+	succeeded := 0
+	for _, errCode := range bookConcurrently(course, newTestStudents(t, students)) {
+		switch errCode {
+		case constval.OK:
+			succeeded++
+		case constval.CourseNotAvailable:
+		default:
+			t.Errorf("unexpected error code %d: %s", errCode, constval.GetErrCodeMsg(errCode))
+		}
+	}
+	enrolled, remainCap := enrollmentOf(t, course)
+	if succeeded != seats || enrolled != seats || remainCap != 0 {
+		t.Errorf("want %d bookings and 0 remain_cap, got %d succeeded, %d enrolled, %d remain_cap",
+			seats, succeeded, enrolled, remainCap)
+	}
+}
+
+func TestBookCourseNoDoubleBooking(t *testing.T) {
+	setupBookingDb(t)
+	const seats, attempts = 10, 20
+	course := newTestCourse(t, seats)
+	student := newTestStudents(t, 1)[0]
+	studentIDs := make([]string, attempts)
+	for i := range studentIDs {
+		studentIDs[i] = student
+	}
+
+	succeeded := 0
+	for _, errCode := range bookConcurrently(course, studentIDs) {
+		switch errCode {
+		case constval.OK:
+			succeeded++
+		case constval.StudentHasCourse:
+		default:
+			t.Errorf("unexpected error code %d: %s", errCode, constval.GetErrCodeMsg(errCode))
+		}
+	}
+	enrolled, remainCap := enrollmentOf(t, course)
+	if succeeded != 1 || enrolled != 1 || remainCap != seats-1 {
+		t.Errorf("want 1 booking and %d remain_cap, got %d succeeded, %d enrolled, %d remain_cap",
+			seats-1, succeeded, enrolled, remainCap)
+	}
+
+	//the unique index rejects a second enrollment which skips BookCourse
+	studentID, _ := strconv.ParseUint(student, 10, 64)
+	err := Db.Create(&StudentCourse{StudentID: studentID, CourseID: course.CourseID, TermID: course.TermID}).Error
+	if !isDuplicateKey(err) {
+		t.Errorf("want duplicate key error, got %v", err)
+	}
+}
+
+func TestBookCourseAsyncNoOversell(t *testing.T) {
+	setupBookingDb(t)
+	const seats, students = 5, 50
+	course := newTestCourse(t, seats)
+	courseID := strconv.FormatUint(course.CourseID, 10)
+	bookingQueue = utility.CreateBoundedQueue(students)
+	defer func() { bookingQueue = nil }()
+
+	accepted := []string{}
+	for _, id := range newTestStudents(t, students) {
+		ticket := Ticket{}
+		_, errCode := BookCourseForm{UserID: id, CourseID: courseID}.BookCourseAsync(Actor{}, &BookResult{}, &ticket)
+		switch errCode {
+		case constval.OK:
+			accepted = append(accepted, ticket.Ticket)
+		case constval.CourseNotAvailable:
+		default:
+			t.Errorf("unexpected error code %d: %s", errCode, constval.GetErrCodeMsg(errCode))
+		}
+	}
+	//write in small batches, as the workers do
+	for !bookingQueue.Empty() {
+		writeBookings(bookingQueue.PopN(2))
+	}
+
+	succeeded := 0
+	for _, id := range accepted {
+		ticket := Ticket{}
+		if _, errCode := (GetTicketForm{Ticket: id}).GetTicket(&ticket); errCode == constval.OK && ticket.Status == TicketSucceeded {
+			succeeded++
+		}
+	}
+	enrolled, remainCap := enrollmentOf(t, course)
+	if len(accepted) != seats || succeeded != seats || enrolled != seats || remainCap != 0 {
+		t.Errorf("want %d bookings and 0 remain_cap, got %d accepted, %d succeeded, %d enrolled, %d remain_cap",
+			seats, len(accepted), succeeded, enrolled, remainCap)
+	}
+}
+
+func TestBookCourseNoTimeConflict(t *testing.T) {
+	setupBookingDb(t)
+	student := newTestStudents(t, 1)[0]
+	courses := []*Course{newTestCourse(t, 10), newTestCourse(t, 10)}
+	for _, course := range courses {
+		slot := &CourseSlot{CourseID: course.CourseID,
+			Slot: timetable.Slot{Weekday: 1, StartPeriod: 1, EndPeriod: 2, StartWeek: 1, EndWeek: 16}}
+		if err := Db.Create(slot).Error; err != nil {
+			t.Fatalf("create course slot error: %v", err)
+		}
+	}
+
+	//both bookings pass the cached check before either is written
+	errCodes := make([]constval.ErrNo, len(courses))
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i, course := range courses {
+		wg.Add(1)
+		go func(i int, courseID string) {
+			defer wg.Done()
+			<-start
+			_, errCodes[i] = BookCourseForm{UserID: student, CourseID: courseID}.BookCourse(Actor{}, &BookResult{})
+		}(i, strconv.FormatUint(course.CourseID, 10))
+	}
+	close(start)
+	wg.Wait()
+
+	succeeded := 0
+	for _, errCode := range errCodes {
+		switch errCode {
+		case constval.OK:
+			succeeded++
+		case constval.CourseTimeConflict:
+		default:
+			t.Errorf("unexpected error code %d: %s", errCode, constval.GetErrCodeMsg(errCode))
+		}
+	}
+	var enrolled int64
+	err := Db.Model(&StudentCourse{}).Where("student_id = ?", student).Count(&enrolled).Error
+	if err != nil {
+		t.Fatalf("query enrollment error: %v", err)
+	}
+	if succeeded != 1 || enrolled != 1 {
+		t.Errorf("want 1 of 2 clashing courses booked, got %d succeeded and %d enrolled", succeeded, enrolled)
+	}
+}
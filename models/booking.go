@@ -0,0 +1,324 @@
+package models
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/cache"
+	"github.com/hollowdjj/course-selecting-sys/conf"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+//status of a booking ticket
+const (
+	TicketPending   = "pending"
+	TicketSucceeded = "succeeded"
+	TicketFailed    = "failed"
+)
+
+//result of an asynchronous booking, kept in memory of the node which accepted the booking. The
+//ticket carries the node, polls reaching other nodes are forwarded to it
+type Ticket struct {
+	Ticket    string         `json:"ticket"`
+	UserID    string         `json:"user_id"`
+	CourseID  string         `json:"course_id"`
+	Status    string         `json:"status"`
+	Code      constval.ErrNo `json:"code"`
+	Reason    string         `json:"reason,omitempty"`
+	Result    *BookResult    `json:"result,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	DoneAt    *time.Time     `json:"done_at,omitempty"`
+}
+
+//a booking waiting in the queue. Its seat is taken from the cached remain_cap already
+type bookingJob struct {
+	form   BookCourseForm
+	actor  Actor
+	plan   bookPlan
+	ticket Ticket
+	result BookResult //details of a rejection found when writing
+}
+
+//remain_cap kept in the shared cache expires after this many seconds and is loaded from db again
+const remainCapCacheTTL = 60
+
+var (
+	bookingQueue *utility.Queue
+	tickets      sync.Map //ticket -> Ticket
+
+	//makes reading and writing remain_cap in the cache atomic on this node
+	seatMu sync.Mutex
+)
+
+//take a seat of the course from remain_cap in the shared cache, so that every node hands out the
+//same seats. The cache only refuses bookings early, db still refuses a booking when remain_cap is 0
+func takeSeat(courseID string) (bool, error) {
+	courseRemainCapCache := cache.GetGroupCache("course_remain_cap")
+	if courseRemainCapCache == nil {
+		courseRemainCapCache = cache.NewGroupCache("course_remain_cap", maxCourseRemainCapBytes, cache.GetterFunc(CourseRemainCapGetter))
+	}
+	seatMu.Lock()
+	defer seatMu.Unlock()
+	val, err := courseRemainCapCache.Get(courseID, cache.DefaultOption)
+	if err != nil {
+		return false, err
+	}
+	if val.Len() == 0 {
+		//the course is deleted
+		return false, nil
+	}
+	remainCap, err := strconv.Atoi(val.String())
+	if err != nil {
+		return false, err
+	}
+	if remainCap <= 0 {
+		return false, nil
+	}
+	courseRemainCapCache.Add(courseID, []byte(strconv.Itoa(remainCap-1)), remainCapCacheTTL)
+	return true, nil
+}
+
+//give back a seat taken by a booking which is refused. Other nodes may have changed the cached
+//value since, so it is dropped rather than incremented and loaded from db on next booking
+func returnSeat(courseID string) {
+	if courseRemainCapCache := cache.GetGroupCache("course_remain_cap"); courseRemainCapCache != nil {
+		courseRemainCapCache.Del(courseID)
+	}
+}
+
+//db says the course is full, no more seats are handed out until the cached value expires or
+//a drop gives a seat back
+func resetSeat(courseID string) {
+	if courseRemainCapCache := cache.GetGroupCache("course_remain_cap"); courseRemainCapCache != nil {
+		courseRemainCapCache.Add(courseID, []byte("0"), remainCapCacheTTL)
+	}
+}
+
+//length of the random part of a ticket, the rest is the hex of the host which queued the booking
+const ticketTokenLen = 32
+
+//a new ticket of this node
+func newTicket() string {
+	return utility.GenerateToken() + hex.EncodeToString([]byte(conf.GetApp().Host))
+}
+
+//the host of the node which holds the ticket, empty if the ticket is malformed
+func TicketNode(ticket string) string {
+	if len(ticket) <= ticketTokenLen {
+		return ""
+	}
+	host, err := hex.DecodeString(ticket[ticketTokenLen:])
+	if err != nil {
+		return ""
+	}
+	return string(host)
+}
+
+//used for polling the result of an asynchronous booking
+type GetTicketForm struct {
+	Ticket string `valid:"Required;AlphaNumeric;MaxSize(160)"`
+}
+
+func (g GetTicketForm) GetTicket(ticket *Ticket) (int, constval.ErrNo) {
+	v, ok := tickets.Load(g.Ticket)
+	if !ok {
+		return http.StatusBadRequest, constval.TicketNotExist
+	}
+	*ticket = v.(Ticket)
+	return http.StatusOK, constval.OK
+}
+
+//check the booking, take a seat and put the booking into the queue. The enrollment is written by
+//booking workers later, ticket is used to poll the result
+func (b BookCourseForm) BookCourseAsync(actor Actor, bookResult *BookResult, ticket *Ticket) (int, constval.ErrNo) {
+	if bookingQueue == nil {
+		return b.BookCourse(actor, bookResult)
+	}
+	plan := bookPlan{}
+	if httpCode, errCode := b.plan(bookResult, &plan); errCode != constval.OK {
+		return httpCode, errCode
+	}
+	taken, err := takeSeat(b.CourseID)
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"course_id": b.CourseID,
+			"err":       err,
+		}).Errorln("load course seats error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if !taken {
+		return http.StatusOK, constval.CourseNotAvailable
+	}
+
+	*ticket = Ticket{
+		Ticket:    newTicket(),
+		UserID:    b.UserID,
+		CourseID:  b.CourseID,
+		Status:    TicketPending,
+		CreatedAt: time.Now(),
+	}
+	tickets.Store(ticket.Ticket, *ticket)
+	if !bookingQueue.TryPush(&bookingJob{form: b, actor: actor, plan: plan, ticket: *ticket}) {
+		tickets.Delete(ticket.Ticket)
+		returnSeat(b.CourseID)
+		return http.StatusServiceUnavailable, constval.BookingBusy
+	}
+	return http.StatusAccepted, constval.OK
+}
+
+//start workers writing queued bookings to db if booking is asynchronous
+func StartBookingWorkers() {
+	booking := conf.GetBooking()
+	if !booking.Async {
+		return
+	}
+	workers, batchSize := utility.Max(booking.Workers, 1), utility.Max(booking.BatchSize, 1)
+	wait := time.Duration(booking.BatchWait) * time.Millisecond
+	if wait <= 0 {
+		wait = 20 * time.Millisecond
+	}
+	ttl := time.Duration(booking.TicketTTL) * time.Second
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+
+	bookingQueue = utility.CreateBoundedQueue(booking.QueueSize)
+	for i := 0; i < workers; i++ {
+		go bookingWorker(batchSize, wait)
+	}
+	go func() {
+		ticker := time.NewTicker(ttl / 2)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			expireTickets(now.Add(-ttl))
+		}
+	}()
+}
+
+func bookingWorker(batchSize int, wait time.Duration) {
+	//only one worker is woken by Ready, the others find new bookings on the next tick
+	ticker := time.NewTicker(wait)
+	defer ticker.Stop()
+	for {
+		jobs := bookingQueue.PopN(batchSize)
+		if len(jobs) == 0 {
+			select {
+			case <-bookingQueue.Ready():
+			case <-ticker.C:
+			}
+			continue
+		}
+		writeBookings(jobs)
+	}
+}
+
+//write a batch of bookings in one transaction. A refused booking is rolled back to its savepoint
+//so that the others are kept. If the transaction fails, every booking is written on its own
+func writeBookings(jobs []interface{}) {
+	errCodes := make([]constval.ErrNo, len(jobs))
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		for i, v := range jobs {
+			job := v.(*bookingJob)
+			savePoint := fmt.Sprintf("booking_%d", i)
+			if err := tx.SavePoint(savePoint).Error; err != nil {
+				return err
+			}
+			errCode, err := job.book(tx)
+			if err != nil {
+				return err
+			}
+			if errCode != constval.OK {
+				if err = tx.RollbackTo(savePoint).Error; err != nil {
+					return err
+				}
+			}
+			errCodes[i] = errCode
+		}
+		return nil
+	})
+	if err != nil {
+		//e.g. a deadlock between two batches locking the same students
+		logger.GetInstance().WithFields(logrus.Fields{
+			"size": len(jobs),
+			"err":  err,
+		}).Warnln("write booking batch error, write one by one")
+		for i, v := range jobs {
+			job := v.(*bookingJob)
+			errCodes[i] = constval.OK
+			err = Db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				errCodes[i], err = job.book(tx)
+				return err
+			})
+			if err != nil {
+				logger.GetInstance().WithFields(logrus.Fields{
+					"user_id":   job.form.UserID,
+					"course_id": job.form.CourseID,
+					"err":       err,
+				}).Errorln("write booking error")
+				errCodes[i] = constval.UnknownError
+			}
+		}
+	}
+	for i, v := range jobs {
+		v.(*bookingJob).finish(errCodes[i])
+	}
+}
+
+//book in tx. A duplicate key means the student has booked the course in another request
+func (job *bookingJob) book(tx *gorm.DB) (constval.ErrNo, error) {
+	job.result = BookResult{}
+	errCode, err := job.form.book(tx, job.actor, &job.plan, &job.result)
+	if isDuplicateKey(err) {
+		return constval.StudentHasCourse, nil
+	}
+	return errCode, err
+}
+
+//update seat counter, cache and ticket after the booking is written or refused
+func (job *bookingJob) finish(errCode constval.ErrNo) {
+	courseID := job.form.CourseID
+	switch errCode {
+	case constval.OK:
+		//the seat is taken from the cached remain_cap already
+		invalidateStudentCourseCache(job.form.UserID, courseID)
+		seatsChanged(courseID)
+	case constval.CourseNotAvailable:
+		resetSeat(courseID)
+	default:
+		returnSeat(courseID)
+	}
+
+	now := time.Now()
+	ticket := job.ticket
+	ticket.Code, ticket.DoneAt = errCode, &now
+	if errCode == constval.OK {
+		ticket.Status = TicketSucceeded
+	} else {
+		ticket.Status = TicketFailed
+		ticket.Reason = constval.GetErrCodeMsg(errCode)
+	}
+	if errCode == constval.CreditLimitExceeded || errCode == constval.CourseTimeConflict {
+		ticket.Result = &job.result
+	}
+	tickets.Store(ticket.Ticket, ticket)
+	publishTicket(ticket)
+}
+
+//drop tickets finished before the deadline
+func expireTickets(deadline time.Time) {
+	tickets.Range(func(key, value interface{}) bool {
+		if ticket := value.(Ticket); ticket.DoneAt != nil && ticket.DoneAt.Before(deadline) {
+			tickets.Delete(key)
+		}
+		return true
+	})
+}
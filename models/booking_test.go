@@ -0,0 +1,15 @@
+package models
+
+import "testing"
+
+func TestTicketNode(t *testing.T) {
+	for ticket, want := range map[string]string{
+		"0123456789abcdef0123456789abcdef" + "31302e302e302e31": "10.0.0.1",
+		"0123456789abcdef0123456789abcdef":                      "",
+		"0123456789abcdef0123456789abcdef" + "zz":               "",
+	} {
+		if got := TicketNode(ticket); got != want {
+			t.Errorf("ticket %s: want node %q, got %q", ticket, want, got)
+		}
+	}
+}
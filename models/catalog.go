@@ -0,0 +1,294 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+//used for creating a catalog course
+type CreateCatalogForm struct {
+	Name        string `form:"name" valid:"Required;MaxSize(255)"`
+	Code        string `form:"code" valid:"Required;MaxSize(32)"`
+	Credits     int    `form:"credits" valid:"Range(0, 20)"`
+	Department  string `form:"department" valid:"MaxSize(64)"`
+	Description string `form:"description" valid:"MaxSize(4096)"`
+	Language    string `form:"language" valid:"MaxSize(32)"`
+	Tags        string `form:"tags" valid:"MaxSize(255)"` //comma separated
+}
+
+func (c CreateCatalogForm) catalog() CatalogCourse {
+	return CatalogCourse{
+		CourseName:  c.Name,
+		Code:        c.Code,
+		Credits:     uint(c.Credits),
+		Department:  c.Department,
+		Description: c.Description,
+		Language:    c.Language,
+		Tags:        normalizeTags(c.Tags),
+	}
+}
+
+//create a catalog course. Code is unique in the catalog
+func (c CreateCatalogForm) CreateCatalog(catalog *CatalogCourse) (int, constval.ErrNo) {
+	created := false
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		*catalog = c.catalog()
+		var err error
+		created, err = findOrCreateCatalog(tx, catalog)
+		return err
+	})
+	if isDuplicateKey(err) {
+		//created by a concurrent request
+		return http.StatusBadRequest, constval.CourseExisted
+	}
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"form": c,
+			"err":  err,
+		}).Errorln("create catalog course error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if !created {
+		return http.StatusBadRequest, constval.CourseExisted
+	}
+	return http.StatusOK, constval.OK
+}
+
+//used for browsing the catalog
+type GetCatalogListForm struct {
+	Limit      int    `form:"limit" valid:"Min(0)"`
+	Cursor     string `form:"cursor" valid:"MaxSize(512)"`
+	Query      string `form:"q" valid:"MaxSize(100)"` //full-text search over name and description
+	Department string `form:"department" valid:"MaxSize(64)"`
+	Language   string `form:"language" valid:"MaxSize(32)"`
+	Tag        string `form:"tag" valid:"MaxSize(32)"`
+}
+
+//build the filtered query of catalog list
+func (g *GetCatalogListForm) query() *gorm.DB {
+	query := Db.Model(&CatalogCourse{})
+	if g.Query != "" {
+		query = query.Where("MATCH(course_name, description) AGAINST(? IN NATURAL LANGUAGE MODE)", g.Query)
+	}
+	if g.Department != "" {
+		query = query.Where("department = ?", g.Department)
+	}
+	if g.Language != "" {
+		query = query.Where("language = ?", g.Language)
+	}
+	if g.Tag != "" {
+		query = query.Where("FIND_IN_SET(?, tags) > 0", strings.TrimSpace(g.Tag))
+	}
+	return query
+}
+
+func (g *GetCatalogListForm) GetCatalogList(catalogs *[]CatalogCourse, total *int64, page *Page) (int, constval.ErrNo) {
+	k := keyset{pk: "catalog_id", sort: "catalog_id", limit: pageSize(g.Limit)}
+	cursor, err := decodeCursor(g.Cursor, k.pk, k.sort)
+	if err != nil {
+		return http.StatusBadRequest, constval.ParamInvalid
+	}
+	k.cursor = cursor
+
+	err = g.query().Count(total).Error
+	if err == nil {
+		err = k.apply(g.query()).Find(catalogs).Error
+	}
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"form": *g,
+			"err":  err,
+		}).Errorln("get catalog list error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	*page = k.page(catalogs, func(i int) (uint64, string) {
+		return (*catalogs)[i].CatalogID, ""
+	})
+	return http.StatusOK, constval.OK
+}
+
+//used for quering sections of a catalog course
+type GetSectionsForm struct {
+	CatalogID uint64 `form:"catalog_id" valid:"Required"`
+	TermID    uint64 `form:"term_id"` //0 means the current term
+}
+
+func (g GetSectionsForm) GetSections(sections *[]Course) (int, constval.ErrNo) {
+	termID, httpCode, errCode := resolveTermID(g.TermID)
+	if errCode != constval.OK {
+		return httpCode, errCode
+	}
+	var count int64
+	err := Db.Model(&CatalogCourse{}).Where("catalog_id = ?", g.CatalogID).Count(&count).Error
+	if err == nil && count > 0 {
+		err = Db.Preload("Slots").Where("catalog_id = ? AND term_id = ?", g.CatalogID, termID).
+			Order("section").Find(sections).Error
+	}
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"catalog_id": g.CatalogID,
+			"err":        err,
+		}).Errorln("query sections error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if count == 0 {
+		return http.StatusBadRequest, constval.CatalogNotExist
+	}
+	return http.StatusOK, constval.OK
+}
+
+//find the catalog course by code and create it from catalog if not found. Without code, it is
+//found by name and created with a generated code. Return whether it is created
+func findOrCreateCatalog(tx *gorm.DB, catalog *CatalogCourse) (bool, error) {
+	found := &CatalogCourse{}
+	query := tx.Where("code = ?", catalog.Code)
+	if catalog.Code == "" {
+		query = tx.Where("course_name = ?", catalog.CourseName).Order("catalog_id")
+	}
+	result := query.Limit(1).Find(found)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		*catalog = *found
+		return false, nil
+	}
+	if catalog.Code != "" {
+		return true, tx.Create(catalog).Error
+	}
+
+	//the code is generated from the id, so it is set right after creating. Codes are unique, so a
+	//random one is used until then
+	catalog.Code = utility.GenerateToken()
+	if err := tx.Create(catalog).Error; err != nil {
+		return false, err
+	}
+	catalog.Code = legacyCode(catalog.CatalogID)
+	return true, tx.Model(catalog).Update("code", catalog.Code).Error
+}
+
+//trim tags, drop empty and repeated ones
+func normalizeTags(tags string) string {
+	result := []string{}
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !containsItem(strings.Join(result, ","), tag) {
+			result = append(result, tag)
+		}
+	}
+	return strings.Join(result, ",")
+}
+
+//code given to catalog courses which were created without one
+func legacyCode(id uint64) string {
+	return fmt.Sprintf("LEGACY-%d", id)
+}
+
+//whether the student holds another section of the course's catalog course in the same term
+func hasOtherSection(tx *gorm.DB, studentID string, course *Course) (bool, error) {
+	if course.CatalogID == 0 {
+		return false, nil
+	}
+	var count int64
+	err := tx.Model(&StudentCourse{}).Joins("JOIN course ON course.course_id = student_course.course_id").
+		Where("student_course.student_id = ? AND course.catalog_id = ? AND course.term_id = ? AND course.course_id <> ?",
+			studentID, course.CatalogID, course.TermID, course.CourseID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+//courses created before the catalog existed become sections of catalog courses matched by
+//code, or by name if they have no code
+func backfillCatalog() error {
+	courses := []Course{}
+	err := Db.Select("course_id", "course_name", "code", "credits").Where("catalog_id = 0").
+		Order("course_id").Find(&courses).Error
+	if err != nil {
+		return err
+	}
+	for _, course := range courses {
+		err = Db.Transaction(func(tx *gorm.DB) error {
+			catalog := &CatalogCourse{CourseName: course.CourseName, Code: course.Code, Credits: course.Credits}
+			if _, err := findOrCreateCatalog(tx, catalog); err != nil {
+				return err
+			}
+			return tx.Model(&Course{}).Where("course_id = ?", course.CourseID).
+				Updates(map[string]interface{}{"catalog_id": catalog.CatalogID, "code": catalog.Code}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//give catalog courses created without a code a generated one and copy it to their sections,
+//then replace the old non-unique index on code by the unique one. The old index is only dropped
+//once the unique one is created, so code stays indexed if creating fails
+func fillCatalogCodes() error {
+	ids := []uint64{}
+	if err := Db.Model(&CatalogCourse{}).Where("code = ''").Pluck("catalog_id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		err := Db.Transaction(func(tx *gorm.DB) error {
+			code := legacyCode(id)
+			err := tx.Model(&CatalogCourse{}).Where("catalog_id = ?", id).Update("code", code).Error
+			if err != nil {
+				return err
+			}
+			return tx.Model(&Course{}).Where("catalog_id = ?", id).Update("code", code).Error
+		})
+		if err != nil {
+			return fmt.Errorf("catalog %d: %w", id, err)
+		}
+	}
+
+	if !Db.Migrator().HasIndex(&CatalogCourse{}, "uk_catalog_course_code") {
+		if err := Db.Migrator().CreateIndex(&CatalogCourse{}, "uk_catalog_course_code"); err != nil {
+			return err
+		}
+	}
+	if Db.Migrator().HasIndex(&CatalogCourse{}, "idx_catalog_course_code") {
+		return Db.Migrator().DropIndex(&CatalogCourse{}, "idx_catalog_course_code")
+	}
+	return nil
+}
+
+//sections which share catalog course, term and section number, such as courses of the same code
+//created before the catalog existed, are numbered by course id. Then the unique index on sections
+//is created, which is done here rather than by tags of Course, since those fields are indexed
+//alone too
+func uniqueSections() error {
+	if Db.Migrator().HasIndex(&Course{}, "uk_course_section") {
+		return nil
+	}
+	dups := []Course{}
+	err := Db.Model(&Course{}).Select("catalog_id", "term_id", "section").Group("catalog_id, term_id, section").
+		Having("COUNT(*) > 1").Find(&dups).Error
+	if err != nil {
+		return err
+	}
+	for _, dup := range dups {
+		ids := []uint64{}
+		err := Db.Model(&Course{}).Where("catalog_id = ? AND term_id = ? AND section = ?", dup.CatalogID, dup.TermID, dup.Section).
+			Order("course_id").Pluck("course_id", &ids).Error
+		if err != nil {
+			return err
+		}
+		//the first one keeps its section
+		for _, id := range ids[1:] {
+			if err := Db.Model(&Course{}).Where("course_id = ?", id).Update("section", legacyCode(id)).Error; err != nil {
+				return fmt.Errorf("course %d: %w", id, err)
+			}
+		}
+	}
+	return Db.Exec("CREATE UNIQUE INDEX uk_course_section ON course (catalog_id, term_id, section)").Error
+}
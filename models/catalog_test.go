@@ -0,0 +1,20 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/astaxie/beego/validation"
+)
+
+func TestCreateCatalogFormCredits(t *testing.T) {
+	for _, tc := range []struct {
+		credits int
+		valid   bool
+	}{{0, true}, {4, true}, {20, true}, {21, false}, {-1, false}} {
+		valid := validation.Validation{}
+		ok, err := valid.Valid(&CreateCatalogForm{Name: "Algebra", Code: "MATH101", Credits: tc.credits})
+		if err != nil || ok != tc.valid {
+			t.Errorf("credits %d: want valid %v, got %v (%v)", tc.credits, tc.valid, ok, err)
+		}
+	}
+}
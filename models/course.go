@@ -0,0 +1,306 @@
+package models
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/astaxie/beego/validation"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//used for updating a course. Only fields which are set are updated
+type UpdateCourseForm struct {
+	CourseID uint64 `json:"course_id" valid:"Required"`
+	Cap      *uint  `json:"cap"`
+	//fields of the catalog course, shared by all of its sections
+	Name        *string `json:"name"`
+	Department  *string `json:"department"`
+	Description *string `json:"description"`
+	Language    *string `json:"language"`
+	Tags        *string `json:"tags"`
+}
+
+//validate optional fields, called by beego validation after the tag rules
+func (u *UpdateCourseForm) Valid(v *validation.Validation) {
+	if u.Cap == nil && len(u.catalogUpdates()) == 0 {
+		v.SetError("name", "nothing to update")
+		return
+	}
+	if u.Name != nil {
+		v.Required(*u.Name, "name")
+		v.MaxSize(*u.Name, 255, "name")
+	}
+	if u.Cap != nil {
+		v.Min(int(*u.Cap), 1, "cap")
+	}
+	if u.Department != nil {
+		v.MaxSize(*u.Department, 64, "department")
+	}
+	if u.Description != nil {
+		v.MaxSize(*u.Description, 4096, "description")
+	}
+	if u.Language != nil {
+		v.MaxSize(*u.Language, 32, "language")
+	}
+	if u.Tags != nil {
+		v.MaxSize(*u.Tags, 255, "tags")
+	}
+}
+
+//columns of the catalog course to update
+func (u *UpdateCourseForm) catalogUpdates() map[string]interface{} {
+	updates := map[string]interface{}{}
+	if u.Name != nil {
+		updates["course_name"] = *u.Name
+	}
+	if u.Department != nil {
+		updates["department"] = *u.Department
+	}
+	if u.Description != nil {
+		updates["description"] = *u.Description
+	}
+	if u.Language != nil {
+		updates["language"] = *u.Language
+	}
+	if u.Tags != nil {
+		updates["tags"] = normalizeTags(*u.Tags)
+	}
+	return updates
+}
+
+//update a course. remain_cap is adjusted by the change of cap, and seats added are offered
+//to the waitlist first. Catalog fields are changed for all sections of the catalog course
+func (u UpdateCourseForm) UpdateCourse(actor Actor) (int, constval.ErrNo) {
+	courseID := strconv.FormatUint(u.CourseID, 10)
+	before, after := &Course{}, &Course{}
+	sections := []uint64{}
+	promotedList := []*Waitlist{}
+	errCode := constval.OK
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Catalog").
+			Where("course_id = ?", u.CourseID).Limit(1).Find(before)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			errCode = constval.CourseNotExist
+			return nil
+		}
+
+		if u.Cap != nil && *u.Cap != before.Cap {
+			enrolled := before.Cap - before.RemainCap
+			if *u.Cap < enrolled {
+				errCode = constval.CapBelowEnrolled
+				return nil
+			}
+			if *u.Cap < before.Cap {
+				err := tx.Model(&Course{}).Where("course_id = ?", u.CourseID).Updates(map[string]interface{}{
+					"cap":        *u.Cap,
+					"remain_cap": gorm.Expr("remain_cap - ?", before.Cap-*u.Cap),
+				}).Error
+				if err != nil {
+					return err
+				}
+			} else {
+				err := tx.Model(&Course{}).Where("course_id = ?", u.CourseID).Update("cap", *u.Cap).Error
+				if err != nil {
+					return err
+				}
+				added := *u.Cap - before.Cap
+				for i := uint(0); i < added; i++ {
+					promoted, err := releaseSeat(tx, u.CourseID)
+					if err != nil {
+						return err
+					}
+					if promoted == nil {
+						//nobody is waiting, the rest seats go to remain_cap at once
+						err = tx.Model(&Course{}).Where("course_id = ?", u.CourseID).
+							Update("remain_cap", gorm.Expr("remain_cap + ?", added-i-1)).Error
+						if err != nil {
+							return err
+						}
+						break
+					}
+					promotedList = append(promotedList, promoted)
+				}
+			}
+		}
+
+		if updates := u.catalogUpdates(); len(updates) > 0 {
+			//course info of every section contains the catalog course
+			err := tx.Model(&Course{}).Where("catalog_id = ?", before.CatalogID).Pluck("course_id", &sections).Error
+			if err != nil {
+				return err
+			}
+			if err = tx.Model(&CatalogCourse{}).Where("catalog_id = ?", before.CatalogID).Updates(updates).Error; err != nil {
+				return err
+			}
+			//name is copied to the sections
+			if u.Name != nil && *u.Name != before.CourseName {
+				err = tx.Model(&Course{}).Where("catalog_id = ?", before.CatalogID).Update("course_name", *u.Name).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := tx.Preload("Catalog").Where("course_id = ?", u.CourseID).First(after).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, actor, AuditUpdateCourse, AuditTargetCourse, courseID, before, after)
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"course_id": u.CourseID,
+			"err":       err,
+		}).Errorln("update course error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if errCode != constval.OK {
+		return http.StatusBadRequest, errCode
+	}
+
+	invalidateSeatCache(courseID)
+	for _, id := range sections {
+		invalidateCourseCache(strconv.FormatUint(id, 10))
+	}
+	for _, promoted := range promotedList {
+		notifyPromoted(promoted)
+	}
+	return http.StatusOK, constval.OK
+}
+
+//used for deleting a course
+type DeleteCourseForm struct {
+	CourseID uint64 `json:"course_id" valid:"Required"`
+}
+
+//delete a course nobody has booked. Its slots, requirement and waitlist are deleted too
+func (d DeleteCourseForm) DeleteCourse(actor Actor) (int, constval.ErrNo) {
+	courseID := strconv.FormatUint(d.CourseID, 10)
+	course := &Course{}
+	errCode := constval.OK
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("course_id = ?", d.CourseID).Limit(1).Find(course)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			errCode = constval.CourseNotExist
+			return nil
+		}
+		//a seat held for a promoted student counts as an enrollment
+		var booked, held int64
+		err := tx.Model(&StudentCourse{}).Where("course_id = ?", d.CourseID).Count(&booked).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&Waitlist{}).Where("course_id = ? AND status = ?", d.CourseID, WaitPromoted).Count(&held).Error
+		if err != nil {
+			return err
+		}
+		if booked+held > 0 {
+			errCode = constval.CourseHasStudents
+			return nil
+		}
+
+		for _, v := range []interface{}{&Waitlist{}, &CourseSlot{}, &CourseRequirement{}} {
+			if err = tx.Where("course_id = ?", d.CourseID).Delete(v).Error; err != nil {
+				return err
+			}
+		}
+		if err = tx.Delete(&Course{}, d.CourseID).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, actor, AuditDeleteCourse, AuditTargetCourse, courseID, course, nil)
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"course_id": d.CourseID,
+			"err":       err,
+		}).Errorln("delete course error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if errCode != constval.OK {
+		return http.StatusBadRequest, errCode
+	}
+	invalidateSeatCache(courseID)
+	return http.StatusOK, constval.OK
+}
+
+//used for listing courses of a term
+type GetCourseListForm struct {
+	Limit      int    `form:"limit" valid:"Min(0)"`
+	Cursor     string `form:"cursor" valid:"MaxSize(512)"`
+	TermID     uint64 `form:"term_id"` //0 means the current term
+	TeacherID  uint64 `form:"teacher_id"`
+	Department string `form:"department" valid:"MaxSize(64)"` //department of the catalog course
+	HasSeats   bool   `form:"has_seats"`
+	Name       string `form:"name" valid:"MaxSize(255)"` //part of course name
+	SortBy     string `form:"sort_by" valid:"Match(/^(|course_id|course_name|remain_cap)$/)"`
+	Order      string `form:"order" valid:"Match(/^(|asc|desc)$/)"`
+}
+
+//build the filtered query of course list
+func (g *GetCourseListForm) query(termID uint64) *gorm.DB {
+	query := Db.Model(&Course{}).Where("term_id = ?", termID)
+	if g.TeacherID != 0 {
+		query = query.Where("teacher_id = ?", g.TeacherID)
+	}
+	if g.Department != "" {
+		query = query.Where("catalog_id IN (?)",
+			Db.Model(&CatalogCourse{}).Select("catalog_id").Where("department = ?", g.Department))
+	}
+	if g.HasSeats {
+		query = query.Where("remain_cap > 0")
+	}
+	if g.Name != "" {
+		query = query.Where("course_name LIKE ?", "%"+utility.EscapeLike(g.Name)+"%")
+	}
+	return query
+}
+
+func (g *GetCourseListForm) GetCourseList(courses *[]Course, total *int64, page *Page) (int, constval.ErrNo) {
+	termID, httpCode, errCode := resolveTermID(g.TermID)
+	if errCode != constval.OK {
+		return httpCode, errCode
+	}
+	k := keyset{pk: "course_id", sort: "course_id", desc: g.Order == "desc", limit: pageSize(g.Limit)}
+	if g.SortBy != "" {
+		k.sort = g.SortBy
+	}
+	cursor, err := decodeCursor(g.Cursor, k.pk, k.sort)
+	if err != nil {
+		return http.StatusBadRequest, constval.ParamInvalid
+	}
+	k.cursor = cursor
+
+	err = g.query(termID).Count(total).Error
+	if err == nil {
+		err = k.apply(g.query(termID)).Find(courses).Error
+	}
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"form": *g,
+			"err":  err,
+		}).Errorln("get course list error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+
+	*page = k.page(courses, func(i int) (uint64, string) {
+		c := (*courses)[i]
+		switch k.sort {
+		case "course_name":
+			return c.CourseID, c.CourseName
+		case "remain_cap":
+			return c.CourseID, strconv.FormatUint(uint64(c.RemainCap), 10)
+		}
+		return c.CourseID, ""
+	})
+	return http.StatusOK, constval.OK
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//used for overriding the credit load of a student in a term, admin only
+type SetCreditLimitForm struct {
+	UserID     uint64 `json:"user_id" valid:"Required"`
+	TermID     uint64 `json:"term_id"` //0 means the current term
+	MinCredits uint   `json:"min_credits"`
+	MaxCredits uint   `json:"max_credits"` //0 means no limit
+}
+
+func (s *SetCreditLimitForm) SetCreditLimit(actor Actor) (int, constval.ErrNo) {
+	if s.MaxCredits > 0 && s.MinCredits > s.MaxCredits {
+		return http.StatusBadRequest, constval.ParamInvalid
+	}
+	termID, httpCode, errCode := resolveTermID(s.TermID)
+	if errCode != constval.OK {
+		return httpCode, errCode
+	}
+
+	limit := &CreditLimit{StudentID: s.UserID, TermID: termID, MinCredits: s.MinCredits, MaxCredits: s.MaxCredits}
+	errCode = constval.OK
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&User{}).Where("user_id = ? AND is_active = 1", s.UserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			errCode = constval.StudentNotExist
+			return nil
+		}
+		if err := tx.Model(&Term{}).Where("term_id = ?", termID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			errCode = constval.TermNotExist
+			return nil
+		}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(limit).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, actor, AuditSetCreditLimit, AuditTargetUser, strconv.FormatUint(s.UserID, 10),
+			nil, limit)
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"form": *s,
+			"err":  err,
+		}).Errorln("set credit limit error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if errCode != constval.OK {
+		return http.StatusBadRequest, errCode
+	}
+	return http.StatusOK, constval.OK
+}
+
+//credit load of a student in a term. The limit set by admin is preferred over limits of the term
+func creditLimitOf(tx *gorm.DB, studentID string, termID uint64, limit *CreditLimit) error {
+	result := tx.Where("student_id = ? AND term_id = ?", studentID, termID).Limit(1).Find(limit)
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+	term := &Term{}
+	if err := tx.Select("min_credits", "max_credits").Where("term_id = ?", termID).Limit(1).Find(term).Error; err != nil {
+		return err
+	}
+	*limit = CreditLimit{TermID: termID, MinCredits: term.MinCredits, MaxCredits: term.MaxCredits}
+	return nil
+}
+
+//total credits of courses booked by a student in a term
+func studentCredits(tx *gorm.DB, studentID string, termID uint64) (uint, error) {
+	var total uint
+	err := tx.Model(&StudentCourse{}).Select("COALESCE(SUM(course.credits), 0)").
+		Joins("JOIN course ON course.course_id = student_course.course_id").
+		Where("student_course.student_id = ? AND student_course.term_id = ?", studentID, termID).
+		Scan(&total).Error
+	return total, err
+}
+
+//lock the student row so that concurrent bookings of a student are checked one by one
+func lockStudent(tx *gorm.DB, studentID string) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("user_id").
+		Where("user_id = ?", studentID).Find(&User{}).Error
+}
+
+//whether booking credits more exceeds maxCredits of the student in the term. The student
+//should be locked by lockStudent first
+func exceedsCredits(tx *gorm.DB, studentID string, termID uint64, credits, maxCredits uint) (bool, error) {
+	booked, err := studentCredits(tx, studentID, termID)
+	if err != nil {
+		return false, err
+	}
+	return booked+credits > maxCredits, nil
+}
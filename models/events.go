@@ -0,0 +1,185 @@
+package models
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/conf"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/event"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+//names of events sent to students
+const (
+	EventBooking = "booking" //result of an asynchronous booking, data is a Ticket
+	EventSeats   = "seats"   //remain_cap of a watched course, data is a Seats
+)
+
+const (
+	maxWatchedCourses = 50
+	watchBuffer       = 64 //events kept for a slow watcher, more are dropped
+	courseTopicPrefix = "course:"
+)
+
+//remain_cap of a course
+type Seats struct {
+	CourseID  uint64 `json:"course_id"`
+	RemainCap uint   `json:"remain_cap"`
+}
+
+func userTopic(userID string) string {
+	return "user:" + userID
+}
+
+func courseTopic(courseID string) string {
+	return courseTopicPrefix + courseID
+}
+
+//used for watching booking results of the login student and seats of courses
+type WatchForm struct {
+	CourseIDs string `form:"course_ids" valid:"MaxSize(1024)"` //comma separated
+}
+
+//subscribe booking results of the student and seats of the courses. Current seats of the courses
+//are put into seats, so that changes are sent on top of them
+func (w WatchForm) Watch(userID string, sub **event.Subscriber, seats *[]Seats) (int, constval.ErrNo) {
+	courseIDs := []uint64{}
+	for _, id := range strings.Split(w.CourseIDs, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		courseID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return http.StatusBadRequest, constval.ParamInvalid
+		}
+		courseIDs = append(courseIDs, courseID)
+	}
+
+	*sub = event.GetHub().Subscribe(watchBuffer, userTopic(userID))
+	httpCode, errCode := watchSeats(*sub, courseIDs, seats)
+	if errCode != constval.OK {
+		event.GetHub().Unsubscribe(*sub)
+	}
+	return httpCode, errCode
+}
+
+//used for changing courses watched over a websocket
+type WatchSeatsForm struct {
+	Action    string   `json:"action" valid:"Match(/^(subscribe|unsubscribe)$/)"`
+	CourseIDs []uint64 `json:"course_ids"`
+}
+
+//subscribe or unsubscribe seats of the courses. sub is created if it is nil. Current seats of the
+//subscribed courses are put into seats
+func (w WatchSeatsForm) WatchSeats(sub **event.Subscriber, seats *[]Seats) (int, constval.ErrNo) {
+	if *sub == nil {
+		*sub = event.GetHub().Subscribe(watchBuffer)
+	}
+	if w.Action == "unsubscribe" {
+		topics := make([]string, 0, len(w.CourseIDs))
+		for _, id := range w.CourseIDs {
+			topics = append(topics, courseTopic(strconv.FormatUint(id, 10)))
+		}
+		event.GetHub().Remove(*sub, topics...)
+		return http.StatusOK, constval.OK
+	}
+	return watchSeats(*sub, w.CourseIDs, seats)
+}
+
+//subscribe seats of the courses and read their current seats
+func watchSeats(sub *event.Subscriber, courseIDs []uint64, seats *[]Seats) (int, constval.ErrNo) {
+	if len(courseIDs) == 0 {
+		return http.StatusOK, constval.OK
+	}
+	topics := []string{}
+	for _, id := range courseIDs {
+		topic := courseTopic(strconv.FormatUint(id, 10))
+		if !containsItem(strings.Join(topics, ","), topic) {
+			topics = append(topics, topic)
+		}
+	}
+	if event.GetHub().Count(sub)+len(topics) > maxWatchedCourses {
+		return http.StatusBadRequest, constval.ParamInvalid
+	}
+
+	//subscribe before reading seats, so that no change is missed in between
+	event.GetHub().Add(sub, topics...)
+	err := Db.Model(&Course{}).Select("course_id", "remain_cap").Where("course_id IN ?", courseIDs).Find(seats).Error
+	if err != nil {
+		event.GetHub().Remove(sub, topics...)
+		logger.GetInstance().WithFields(logrus.Fields{
+			"course_ids": courseIDs,
+			"err":        err,
+		}).Errorln("query watched seats error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	return http.StatusOK, constval.OK
+}
+
+var (
+	changedMu      sync.Mutex
+	changedCourses = map[string]struct{}{} //courses whose remain_cap changed since the last flush
+)
+
+//mark remain_cap of the course changed. It is called wherever remain_cap is written, and the
+//changes are sent by StartSeatEvents
+func seatsChanged(courseID string) {
+	changedMu.Lock()
+	changedCourses[courseID] = struct{}{}
+	changedMu.Unlock()
+}
+
+//send remain_cap of changed courses to their watchers on every node MaxRate times a second, so
+//that changes of a course in between are sent as one
+func StartSeatEvents() {
+	rate := conf.GetSeats().MaxRate
+	if rate <= 0 {
+		rate = 1
+	}
+	go func() {
+		ticker := time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := publishSeats(); err != nil {
+				logger.GetInstance().WithField("err", err).Errorln("publish seats error")
+			}
+		}
+	}()
+}
+
+//broadcast remain_cap of the courses changed since the last call
+func publishSeats() error {
+	changedMu.Lock()
+	courseIDs := make([]string, 0, len(changedCourses))
+	for id := range changedCourses {
+		courseIDs = append(courseIDs, id)
+	}
+	changedCourses = map[string]struct{}{}
+	changedMu.Unlock()
+	if len(courseIDs) == 0 {
+		return nil
+	}
+
+	seats := []Seats{}
+	if err := Db.Model(&Course{}).Select("course_id", "remain_cap").Where("course_id IN ?", courseIDs).Find(&seats).Error; err != nil {
+		//send them on next call
+		for _, id := range courseIDs {
+			seatsChanged(id)
+		}
+		return err
+	}
+	for _, s := range seats {
+		event.GetHub().Broadcast(courseTopic(strconv.FormatUint(s.CourseID, 10)), EventSeats, s)
+	}
+	return nil
+}
+
+//send the finished ticket to the student
+func publishTicket(ticket Ticket) {
+	event.GetHub().Broadcast(userTopic(ticket.UserID), EventBooking, ticket)
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+const exportBatchSize = 500
+
+//header of exported users
+var UserExportHeader = []string{"user_id", "username", "nickname", "user_type", "is_active"}
+
+func (u UserInfo) CsvRecord() []string {
+	return []string{
+		strconv.FormatUint(u.UserID, 10),
+		u.Username,
+		u.Nickname,
+		strconv.Itoa(u.UserType),
+		strconv.Itoa(u.IsActive),
+	}
+}
+
+//header of exported courses
+var CourseExportHeader = []string{"course_id", "course_name", "cap", "remain_cap", "teacher_id"}
+
+func (c Course) CsvRecord() []string {
+	teacherID := ""
+	if c.TeacherID != nil {
+		teacherID = strconv.FormatUint(*c.TeacherID, 10)
+	}
+	return []string{
+		strconv.FormatUint(c.CourseID, 10),
+		c.CourseName,
+		strconv.FormatUint(uint64(c.Cap), 10),
+		strconv.FormatUint(uint64(c.RemainCap), 10),
+		teacherID,
+	}
+}
+
+//used for exporting
+type ExportForm struct {
+	Format string `form:"format" valid:"Required;Match(/^(csv|jsonl)$/)"`
+}
+
+//stream users matching the list filters in batches, order by user_id
+func (g *GetUserListForm) ExportUsers(each func(UserInfo) error) error {
+	users := []User{}
+	return g.query().FindInBatches(&users, exportBatchSize, func(tx *gorm.DB, batch int) error {
+		for i := range users {
+			if err := each(users[i].Info()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+//used for exporting enrolled students of a course
+type ExportCourseStudentsForm struct {
+	CourseID uint64 `form:"course_id" valid:"Required"`
+}
+
+//stream active students enrolled in a course row by row
+func (e *ExportCourseStudentsForm) ExportCourseStudents(each func(UserInfo) error) error {
+	rows, err := Db.Model(&User{}).
+		Select("user.user_id, user.user_type, user.username, user.nickname, user.is_active").
+		Joins("JOIN student_course ON student_course.student_id = user.user_id").
+		Where("student_course.course_id = ? AND user.is_active = 1", e.CourseID).
+		Order("user.user_id").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		userInfo := UserInfo{}
+		if err := Db.ScanRows(rows, &userInfo); err != nil {
+			return err
+		}
+		if err := each(userInfo); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+//stream courses of a teacher in a term in batches, call ResolveTerm first
+func (g GetTeacherCourseForm) ExportTeacherCourses(each func(Course) error) error {
+	courses := []Course{}
+	return Db.Where("teacher_id = ? AND term_id = ?", g.TeacherID, g.TermID).
+		FindInBatches(&courses, exportBatchSize, func(tx *gorm.DB, batch int) error {
+			for i := range courses {
+				if err := each(courses[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
 	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
@@ -39,10 +40,23 @@ func UserInfoGetter(username string) ([]byte, error) {
 	return data, nil
 }
 
+//cache Getter of session, key is the hash of the token
+func SessionGetter(tokenHash string) ([]byte, error) {
+	userInfo := &UserInfo{}
+	_, errCode := getUserInfoBySession(tokenHash, userInfo)
+	if errCode == constval.LoginRequired {
+		return nil, nil
+	}
+	if errCode != constval.OK {
+		return nil, fmt.Errorf("query session error: %s", constval.GetErrCodeMsg(errCode))
+	}
+	return json.Marshal(userInfo)
+}
+
 func UserInfoGetterByUserID(id string) ([]byte, error) {
 	//query
 	userInfo := &UserInfo{}
-	err := Db.Model(&User{}).Where("userid = ?", id).First(&userInfo).Error
+	err := Db.Model(&User{}).Where("user_id = ? AND is_active = 1", id).First(&userInfo).Error
 	if err != nil && err != gorm.ErrRecordNotFound {
 		logger.GetInstance().WithFields(logrus.Fields{
 			"userid": id,
@@ -53,6 +67,13 @@ func UserInfoGetterByUserID(id string) ([]byte, error) {
 	if userInfo.UserID == 0 {
 		return nil, nil
 	}
+	if err := LoadProfile(userInfo); err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid": id,
+			"err":    err,
+		}).Errorln("query user profile by id error")
+		return nil, err
+	}
 	//marshal
 	data, err := json.Marshal(userInfo)
 	if err != nil {
@@ -68,7 +89,7 @@ func UserInfoGetterByUserID(id string) ([]byte, error) {
 //cache Getter of course
 func CourseInfoGetter(courseID string) ([]byte, error) {
 	course := &Course{}
-	result := Db.Where("course_id = ?", courseID).First(course)
+	result := Db.Preload("Slots").Preload("Requirement").Preload("Catalog").Where("course_id = ?", courseID).First(course)
 	if result.RowsAffected == 0 {
 		logger.GetInstance().WithField("course_id", courseID).Infoln("course not exist")
 		return nil, nil
@@ -122,10 +143,14 @@ func StudentCourseGetter(key string) ([]byte, error) {
 		}).Errorln("check key pattern error")
 		return nil, err
 	}
-	//get all student courses
+	//get all student courses of the current term
 	if queryCourse {
+		termID, err := currentTermID()
+		if err != nil {
+			return nil, err
+		}
 		studentCourses := []StudentCourse{}
-		err := Db.Model(&Course{}).Select("course_id").Where("student_id = ?", key).Find(&studentCourses).Error
+		err = Db.Select("course_id").Where("student_id = ? AND term_id = ?", key, termID).Find(&studentCourses).Error
 		if err != nil && err != gorm.ErrRecordNotFound {
 			logger.GetInstance().WithFields(logrus.Fields{
 				"student_id": key,
@@ -133,6 +158,9 @@ func StudentCourseGetter(key string) ([]byte, error) {
 			}).Errorln("query student courses error")
 			return nil, err
 		}
+		if len(studentCourses) == 0 {
+			return nil, nil
+		}
 		ret := ""
 		for i := 0; i < len(studentCourses)-1; i++ {
 			ret += fmt.Sprintf("%d", studentCourses[i].CourseID) + "_"
@@ -171,3 +199,31 @@ func StudentCourseGetter(key string) ([]byte, error) {
 
 	return []byte("1"), nil
 }
+
+//cache Getter of the open term, return term id
+func CurrentTermGetter(key string) ([]byte, error) {
+	term := &Term{}
+	result := Db.Select("term_id").Where("status = ?", TermOpen).Limit(1).Find(term)
+	if err := result.Error; err != nil {
+		logger.GetInstance().WithField("err", err).Errorln("query current term error")
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return []byte(strconv.FormatUint(term.TermID, 10)), nil
+}
+
+//cache Getter of enrollment phases, key is term id
+func EnrollmentPhaseGetter(termID string) ([]byte, error) {
+	phases := []EnrollmentPhase{}
+	err := Db.Where("term_id = ?", termID).Order("start_at").Find(&phases).Error
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"term_id": termID,
+			"err":     err,
+		}).Errorln("query enrollment phases error")
+		return nil, err
+	}
+	return json.Marshal(phases)
+}
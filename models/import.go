@@ -0,0 +1,252 @@
+package models
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/app"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	maxImportRows        = 10000
+	importBatchSize      = 200
+	generatedPasswordLen = 12
+)
+
+//import result status of a row
+const (
+	ImportValid   = "valid" //passed validation in dry-run mode
+	ImportCreated = "created"
+	ImportFailed  = "failed"
+)
+
+//result of a row of the uploaded csv
+type ImportResult struct {
+	Line     int    `json:"line"`
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"` //only set when password is generated
+	UserID   uint64 `json:"user_id,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+//header of the downloadable csv report
+var ImportReportHeader = []string{"line", "username", "password", "user_id", "status", "error"}
+
+func (r ImportResult) CsvRecord() []string {
+	userID := ""
+	if r.UserID != 0 {
+		userID = strconv.FormatUint(r.UserID, 10)
+	}
+	return []string{strconv.Itoa(r.Line), r.Username, r.Password, userID, r.Status, r.Error}
+}
+
+//used for importing users from csv. The csv must have a header line with columns
+//username, password, nickname and user_type. An empty password is generated
+type ImportUsersForm struct {
+	DryRun bool   `form:"dry_run"`
+	Format string `form:"format" valid:"Match(/^(|json|csv)$/)"` //report format
+}
+
+func (f *ImportUsersForm) ImportUsers(r io.Reader, actor Actor, results *[]ImportResult) (int, constval.ErrNo) {
+	rows, errCode := parseImportCsv(r)
+	if errCode != constval.OK {
+		return http.StatusBadRequest, errCode
+	}
+
+	//validate rows with the same rules as CreateUserForm
+	funcs := app.CustomFunc{"PasswordCheck": utility.PasswordCheck}
+	seen := make(map[string]bool, len(rows))
+	usernames := make([]string, 0, len(rows))
+	for i := range rows {
+		res := &rows[i].result
+		if res.Status == ImportFailed {
+			seen[rows[i].form.Username] = true
+			continue
+		}
+		errs, err := app.ValidCustom(&rows[i].form, funcs)
+		if err != nil {
+			logger.GetInstance().WithField("err", err).Errorln("validate import row error")
+			return http.StatusInternalServerError, constval.UnknownError
+		}
+		switch {
+		case len(errs) > 0:
+			res.Status, res.Error = ImportFailed, errs[0].Key+": "+errs[0].Message
+		case seen[rows[i].form.Username]:
+			res.Status, res.Error = ImportFailed, "duplicate username in file"
+		default:
+			res.Status = ImportValid
+			usernames = append(usernames, rows[i].form.Username)
+		}
+		seen[rows[i].form.Username] = true
+	}
+
+	//usernames which already exist
+	existed := []string{}
+	for i := 0; i < len(usernames); i += importBatchSize {
+		batch := []string{}
+		err := Db.Model(&User{}).Where("username IN ?", usernames[i:utility.Min(i+importBatchSize, len(usernames))]).
+			Pluck("username", &batch).Error
+		if err != nil {
+			logger.GetInstance().WithField("err", err).Errorln("query existed usernames error")
+			return http.StatusInternalServerError, constval.UnknownError
+		}
+		existed = append(existed, batch...)
+	}
+	existedSet := make(map[string]bool, len(existed))
+	for _, username := range existed {
+		existedSet[username] = true
+	}
+	valid := make([]*importRow, 0, len(rows))
+	for i := range rows {
+		if rows[i].result.Status != ImportValid {
+			continue
+		}
+		if existedSet[rows[i].form.Username] {
+			rows[i].result.Status, rows[i].result.Error = ImportFailed, constval.GetErrCodeMsg(constval.UserExisted)
+			continue
+		}
+		valid = append(valid, &rows[i])
+	}
+
+	if !f.DryRun {
+		for i := 0; i < len(valid); i += importBatchSize {
+			insertImportBatch(valid[i:utility.Min(i+importBatchSize, len(valid))], actor)
+		}
+	}
+
+	for i := range rows {
+		*results = append(*results, rows[i].result)
+	}
+	return http.StatusOK, constval.OK
+}
+
+type importRow struct {
+	form   CreateUserForm
+	result ImportResult
+}
+
+//parse csv and fill in generated passwords
+func parseImportCsv(r io.Reader) ([]importRow, constval.ErrNo) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, constval.ImportFileInvalid
+	}
+	index := map[string]int{}
+	for i, col := range header {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(col, "\ufeff")))] = i
+	}
+	for _, col := range []string{"username", "password", "nickname", "user_type"} {
+		if _, ok := index[col]; !ok {
+			return nil, constval.ImportFileInvalid
+		}
+	}
+
+	rows := []importRow{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, constval.ImportFileInvalid
+		}
+		if len(rows) >= maxImportRows {
+			return nil, constval.ImportTooManyRows
+		}
+
+		row := importRow{result: ImportResult{Line: line}}
+		row.form.Username = record[index["username"]]
+		row.form.Password = record[index["password"]]
+		row.form.Nickname = record[index["nickname"]]
+		row.result.Username = row.form.Username
+		if row.form.Password == "" {
+			row.form.Password = utility.GeneratePassword(generatedPasswordLen)
+			row.result.Password = row.form.Password
+		}
+		userType, err := strconv.Atoi(record[index["user_type"]])
+		if err != nil {
+			row.result.Status, row.result.Error = ImportFailed, "user_type must be an integer"
+		}
+		row.form.UserType = userType
+		rows = append(rows, row)
+	}
+	return rows, constval.OK
+}
+
+//insert a batch of users in one transaction. If the batch fails, e.g. a username is taken by
+//another request since checked, the rows are inserted one by one so that only the bad ones fail
+func insertImportBatch(rows []*importRow, actor Actor) {
+	err := insertImportRows(rows, actor)
+	if err == nil {
+		return
+	}
+	logger.GetInstance().WithFields(logrus.Fields{
+		"first_line": rows[0].result.Line,
+		"rows":       len(rows),
+		"err":        err,
+	}).Warnln("insert import batch error, insert one by one")
+	for _, row := range rows {
+		if len(rows) > 1 {
+			err = insertImportRows([]*importRow{row}, actor)
+		}
+		if err == nil {
+			continue
+		}
+		logger.GetInstance().WithFields(logrus.Fields{
+			"line": row.result.Line,
+			"err":  err,
+		}).Errorln("insert import row error")
+		row.result.Status, row.result.Password = ImportFailed, ""
+		if isDuplicateKey(err) {
+			row.result.Error = constval.GetErrCodeMsg(constval.UserExisted)
+		} else {
+			row.result.Error = fmt.Sprintf("insert error: %v", err)
+		}
+	}
+}
+
+//insert users of rows in one transaction and mark them created
+func insertImportRows(rows []*importRow, actor Actor) error {
+	users := make([]User, len(rows))
+	for i, row := range rows {
+		users[i] = User{
+			Username: row.form.Username,
+			Password: row.form.Password,
+			Nickname: row.form.Nickname,
+			UserType: row.form.UserType,
+			IsActive: 1,
+		}
+	}
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&users).Error; err != nil {
+			return err
+		}
+		for i := range users {
+			err := writeAudit(tx, actor, AuditCreateUser, AuditTargetUser, strconv.FormatUint(users[i].UserID, 10),
+				nil, users[i].Info())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		row.result.Status, row.result.UserID = ImportCreated, users[i].UserID
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 
+	driver "github.com/go-sql-driver/mysql"
 	"github.com/hollowdjj/course-selecting-sys/conf"
 	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/schema"
@@ -32,6 +35,73 @@ func InitDb() {
 	mysqlDB, _ := Db.DB()
 	mysqlDB.SetMaxIdleConns(10)
 	mysqlDB.SetMaxOpenConns(100)
+
+	migrate()
+}
+
+//create tables which are introduced after the initial schema
+func migrate() {
+	//catalog codes become unique, so empty codes are filled in before the index is created
+	if Db.Migrator().HasTable(&CatalogCourse{}) {
+		if err := fillCatalogCodes(); err != nil {
+			logger.GetInstance().WithField("err", err).Fatalln("fill catalog codes fail")
+		}
+	}
+	err := Db.AutoMigrate(&Session{}, &PasswordReset{}, &ApiKey{}, &AuditLog{}, &Profile{}, &Term{}, &EnrollmentPhase{}, &CourseSlot{}, &CourseRequirement{}, &CreditLimit{}, &Waitlist{}, &CatalogCourse{})
+	if err != nil {
+		logger.GetInstance().WithField("err", err).Fatalln("auto migrate tables fail")
+	}
+	if err := hashSessionTokens(); err != nil {
+		logger.GetInstance().WithField("err", err).Fatalln("hash session tokens fail")
+	}
+	//columns added to the initial tables
+	for _, c := range []struct {
+		model interface{}
+		field string
+		index bool
+	}{{&User{}, "DeactivatedAt", false}, {&User{}, "AuthSource", false}, {&Course{}, "TermID", true}, {&Course{}, "Code", true}, {&Course{}, "Credits", false}, {&Course{}, "CatalogID", true}, {&Course{}, "Section", false}, {&StudentCourse{}, "TermID", true}} {
+		if !Db.Migrator().HasColumn(c.model, c.field) {
+			if err := Db.Migrator().AddColumn(c.model, c.field); err != nil {
+				logger.GetInstance().WithFields(logrus.Fields{
+					"field": c.field,
+					"err":   err,
+				}).Fatalln("add column fail")
+			}
+		}
+		if c.index && !Db.Migrator().HasIndex(c.model, c.field) {
+			if err := Db.Migrator().CreateIndex(c.model, c.field); err != nil {
+				logger.GetInstance().WithFields(logrus.Fields{
+					"field": c.field,
+					"err":   err,
+				}).Fatalln("create index fail")
+			}
+		}
+	}
+	//fails if a student booked a course twice, the duplicated rows should be removed first
+	if !Db.Migrator().HasIndex(&StudentCourse{}, "uk_student_course") {
+		if err := Db.Migrator().CreateIndex(&StudentCourse{}, "uk_student_course"); err != nil {
+			logger.GetInstance().WithField("err", err).Fatalln("create unique index of student_course fail")
+		}
+	}
+	if err := backfillDeactivatedAt(); err != nil {
+		logger.GetInstance().WithField("err", err).Fatalln("backfill deactivated_at of users fail")
+	}
+	if err := backfillTerm(); err != nil {
+		logger.GetInstance().WithField("err", err).Fatalln("backfill term of courses fail")
+	}
+	if err := backfillCatalog(); err != nil {
+		logger.GetInstance().WithField("err", err).Fatalln("backfill catalog courses fail")
+	}
+	//sections are matched to catalog courses above, so the index covers all of them
+	if err := uniqueSections(); err != nil {
+		logger.GetInstance().WithField("err", err).Fatalln("create unique index of sections fail")
+	}
+}
+
+//whether err is a violation of a unique index
+func isDuplicateKey(err error) bool {
+	var mysqlErr *driver.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
 }
 
 func CloseDB() {
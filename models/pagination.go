@@ -0,0 +1,123 @@
+package models
+
+import (
+	"reflect"
+
+	"github.com/hollowdjj/course-selecting-sys/conf"
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
+	"gorm.io/gorm"
+)
+
+const defaultMaxPageSize = 100
+
+//cursors returned with a keyset paginated list, empty means no more pages
+type Page struct {
+	NextCursor string `json:"next_cursor"`
+	PrevCursor string `json:"prev_cursor"`
+}
+
+//clamp limit to (0, MaxPageSize]
+func pageSize(limit int) int {
+	maxSize := conf.GetApp().MaxPageSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxPageSize
+	}
+	if limit <= 0 || limit > maxSize {
+		return maxSize
+	}
+	return limit
+}
+
+//keyset describes how a list is ordered. Rows are ordered by sort column and then
+//by primary key, so the order is stable even if the sort column is not unique
+type keyset struct {
+	pk     string //primary key column
+	sort   string //sort column, equals to pk when sorted by primary key
+	desc   bool
+	cursor *utility.Cursor //nil for the first page
+	limit  int
+}
+
+//add where, order and limit clauses to query. One more row than limit is queried
+//to find out whether there is a next page
+func (k keyset) apply(query *gorm.DB) *gorm.DB {
+	//walking backward is walking forward in the reversed order
+	desc := k.desc
+	if k.cursor != nil && !k.cursor.Forward {
+		desc = !desc
+	}
+	op, dir := ">", " ASC"
+	if desc {
+		op, dir = "<", " DESC"
+	}
+
+	if k.cursor != nil {
+		if k.sort == k.pk {
+			query = query.Where(k.pk+" "+op+" ?", k.cursor.ID)
+		} else {
+			query = query.Where("("+k.sort+" "+op+" ? OR ("+k.sort+" = ? AND "+k.pk+" "+op+" ?))",
+				k.cursor.Value, k.cursor.Value, k.cursor.ID)
+		}
+	}
+	if k.sort != k.pk {
+		query = query.Order(k.sort + dir)
+	}
+	return query.Order(k.pk + dir).Limit(k.limit + 1)
+}
+
+//trim the extra row, restore natural order of a backward page and build cursors.
+//rows must be a pointer to the slice queried by apply, keyOf returns primary key
+//and sort column value of the i-th row
+func (k keyset) page(rows interface{}, keyOf func(i int) (uint64, string)) Page {
+	v := reflect.ValueOf(rows).Elem()
+	hasMore := v.Len() > k.limit
+	if hasMore {
+		v.Set(v.Slice(0, k.limit))
+	}
+	backward := k.cursor != nil && !k.cursor.Forward
+	if backward {
+		swap := reflect.Swapper(v.Interface())
+		for i, j := 0, v.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	page := Page{}
+	n := v.Len()
+	if n == 0 {
+		return page
+	}
+	cursorOf := func(i int, forward bool) string {
+		id, value := keyOf(i)
+		c := utility.Cursor{ID: id, Forward: forward}
+		if k.sort != k.pk {
+			c.Sort, c.Value = k.sort, value
+		}
+		return utility.EncodeCursor(c)
+	}
+	//forward: a next page exists if there are more rows, a previous page exists if
+	//we came from one. backward is the other way round
+	if (!backward && hasMore) || backward {
+		page.NextCursor = cursorOf(n-1, true)
+	}
+	if (backward && hasMore) || (!backward && k.cursor != nil) {
+		page.PrevCursor = cursorOf(0, false)
+	}
+	return page
+}
+
+//decode cursor string of a list sorted by sort column, empty string means first page
+func decodeCursor(s, pk, sort string) (*utility.Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	c, err := utility.DecodeCursor(s)
+	if err != nil {
+		return nil, err
+	}
+	if (sort == pk && c.Sort != "") || (sort != pk && c.Sort != sort) {
+		//cursor was built for another order
+		return nil, utility.ErrInvalidCursor
+	}
+	return &c, nil
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+//a db which only builds sql, no connection is made
+func dryRunDb(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "dry:run@tcp(127.0.0.1:1)/dry", SkipInitializeWithVersion: true}),
+		&gorm.Config{
+			DryRun:               true,
+			DisableAutomaticPing: true,
+			NamingStrategy:       schema.NamingStrategy{SingularTable: true},
+			Logger:               gormlogger.Discard,
+		})
+	if err != nil {
+		t.Fatalf("open dry run db error: %v", err)
+	}
+	return db
+}
+
+func TestKeysetApply(t *testing.T) {
+	db := dryRunDb(t)
+	for _, tc := range []struct {
+		name  string
+		k     keyset
+		where string
+		order string
+		vars  []interface{}
+	}{
+		{
+			name:  "first page by pk",
+			k:     keyset{pk: "user_id", sort: "user_id", limit: 10},
+			order: "ORDER BY user_id ASC LIMIT 11",
+		},
+		{
+			name:  "next page by pk desc",
+			k:     keyset{pk: "user_id", sort: "user_id", desc: true, limit: 10, cursor: &utility.Cursor{ID: 7, Forward: true}},
+			where: "WHERE user_id < ?",
+			order: "ORDER BY user_id DESC LIMIT 11",
+			vars:  []interface{}{uint64(7)},
+		},
+		{
+			name:  "previous page by pk reverses the order",
+			k:     keyset{pk: "user_id", sort: "user_id", limit: 10, cursor: &utility.Cursor{ID: 7}},
+			where: "WHERE user_id < ?",
+			order: "ORDER BY user_id DESC LIMIT 11",
+			vars:  []interface{}{uint64(7)},
+		},
+		{
+			name: "next page by non-pk sort breaks ties by pk",
+			k: keyset{pk: "user_id", sort: "username", limit: 10,
+				cursor: &utility.Cursor{ID: 7, Sort: "username", Value: "bob", Forward: true}},
+			where: "WHERE (username > ? OR (username = ? AND user_id > ?))",
+			order: "ORDER BY username ASC,user_id ASC LIMIT 11",
+			vars:  []interface{}{"bob", "bob", uint64(7)},
+		},
+		{
+			name: "previous page by non-pk sort desc",
+			k: keyset{pk: "user_id", sort: "username", desc: true, limit: 10,
+				cursor: &utility.Cursor{ID: 7, Sort: "username", Value: "bob"}},
+			where: "WHERE (username > ? OR (username = ? AND user_id > ?))",
+			order: "ORDER BY username ASC,user_id ASC LIMIT 11",
+			vars:  []interface{}{"bob", "bob", uint64(7)},
+		},
+	} {
+		stmt := tc.k.apply(db.Model(&User{})).Find(&[]User{}).Statement
+		want := "SELECT * FROM `user` " + tc.where
+		if tc.where != "" {
+			want += " "
+		}
+		want += tc.order
+		if got := stmt.SQL.String(); got != want {
+			t.Errorf("%s: want sql %q, got %q", tc.name, want, got)
+		}
+		if len(tc.vars) > 0 && !reflect.DeepEqual(stmt.Vars, tc.vars) {
+			t.Errorf("%s: want vars %v, got %v", tc.name, tc.vars, stmt.Vars)
+		}
+	}
+}
+
+func TestKeysetPage(t *testing.T) {
+	rowsOf := func(ids ...uint64) []User {
+		rows := make([]User, 0, len(ids))
+		for _, id := range ids {
+			rows = append(rows, User{UserID: id, Username: fmt.Sprintf("u%d", id)})
+		}
+		return rows
+	}
+	for _, tc := range []struct {
+		name       string
+		k          keyset
+		rows       []User //as queried by apply
+		want       []uint64
+		next, prev *utility.Cursor
+	}{
+		{
+			name: "first page with more rows",
+			k:    keyset{pk: "user_id", sort: "user_id", limit: 2},
+			rows: rowsOf(1, 2, 3),
+			want: []uint64{1, 2},
+			next: &utility.Cursor{ID: 2, Forward: true},
+		},
+		{
+			name: "only page",
+			k:    keyset{pk: "user_id", sort: "user_id", limit: 2},
+			rows: rowsOf(1, 2),
+			want: []uint64{1, 2},
+		},
+		{
+			name: "last page",
+			k:    keyset{pk: "user_id", sort: "user_id", limit: 2, cursor: &utility.Cursor{ID: 2, Forward: true}},
+			rows: rowsOf(3),
+			want: []uint64{3},
+			prev: &utility.Cursor{ID: 3},
+		},
+		{
+			name: "backward page with more rows before it",
+			k:    keyset{pk: "user_id", sort: "user_id", limit: 2, cursor: &utility.Cursor{ID: 5}},
+			rows: rowsOf(4, 3, 2),
+			want: []uint64{3, 4},
+			next: &utility.Cursor{ID: 4, Forward: true},
+			prev: &utility.Cursor{ID: 3},
+		},
+		{
+			name: "backward page reaching the first row",
+			k:    keyset{pk: "user_id", sort: "user_id", limit: 2, cursor: &utility.Cursor{ID: 3}},
+			rows: rowsOf(2, 1),
+			want: []uint64{1, 2},
+			next: &utility.Cursor{ID: 2, Forward: true},
+		},
+		{
+			name: "cursors of non-pk sort carry the sort value",
+			k: keyset{pk: "user_id", sort: "username", limit: 1,
+				cursor: &utility.Cursor{ID: 1, Sort: "username", Value: "u1", Forward: true}},
+			rows: rowsOf(2, 3),
+			want: []uint64{2},
+			next: &utility.Cursor{ID: 2, Sort: "username", Value: "u2", Forward: true},
+			prev: &utility.Cursor{ID: 2, Sort: "username", Value: "u2"},
+		},
+		{
+			name: "empty page",
+			k:    keyset{pk: "user_id", sort: "user_id", limit: 2, cursor: &utility.Cursor{ID: 9, Forward: true}},
+		},
+	} {
+		rows := tc.rows
+		page := tc.k.page(&rows, func(i int) (uint64, string) {
+			return rows[i].UserID, rows[i].Username
+		})
+		got := []uint64{}
+		for _, row := range rows {
+			got = append(got, row.UserID)
+		}
+		if len(got) != len(tc.want) || (len(got) > 0 && !reflect.DeepEqual(got, tc.want)) {
+			t.Errorf("%s: want rows %v, got %v", tc.name, tc.want, got)
+		}
+		for _, c := range []struct {
+			kind string
+			want *utility.Cursor
+			got  string
+		}{{"next", tc.next, page.NextCursor}, {"prev", tc.prev, page.PrevCursor}} {
+			want := ""
+			if c.want != nil {
+				want = utility.EncodeCursor(*c.want)
+			}
+			if c.got != want {
+				t.Errorf("%s: want %s cursor %q, got %q", tc.name, c.kind, want, c.got)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/notify"
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	passwordResetTTL = 30 * time.Minute
+)
+
+//used for changing password of current user
+type ChangePasswordForm struct {
+	OldPassword string `json:"old_password" valid:"Required;MinSize(8);MaxSize(20)"`
+	NewPassword string `json:"new_password" valid:"Required;MinSize(8);MaxSize(20);PasswordCheck"`
+}
+
+func (c *ChangePasswordForm) ChangePassword(userID uint64) (int, constval.ErrNo) {
+	if !localPasswordEnabled() {
+		return http.StatusBadRequest, constval.PermDenied
+	}
+	user := &User{}
+	result := Db.Select("password").Where("user_id = ? AND is_active = 1", userID).Limit(1).Find(user)
+	if err := result.Error; err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": userID,
+			"err":     err,
+		}).Errorln("query user password error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if result.RowsAffected == 0 {
+		return http.StatusBadRequest, constval.UserDeletedOrNotExist
+	}
+	if user.Password != c.OldPassword {
+		return http.StatusBadRequest, constval.WrongPassword
+	}
+
+	if err := updatePassword(Db, userID, c.NewPassword); err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": userID,
+			"err":     err,
+		}).Errorln("update password error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	afterPasswordUpdated(userID)
+	return http.StatusOK, constval.OK
+}
+
+//used for issuing a one-time password reset token, admin only
+type IssuePasswordResetForm struct {
+	UserID uint64 `json:"user_id" valid:"Required"`
+}
+
+//generate a reset token and deliver it to user by notify.Sender
+func (i *IssuePasswordResetForm) IssuePasswordReset(issuerID uint64) (int, constval.ErrNo) {
+	if !localPasswordEnabled() {
+		return http.StatusBadRequest, constval.PermDenied
+	}
+	user := &User{}
+	result := Db.Select("username").Where("user_id = ? AND is_active = 1", i.UserID).Limit(1).Find(user)
+	if err := result.Error; err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": i.UserID,
+			"err":     err,
+		}).Errorln("query user error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if result.RowsAffected == 0 {
+		return http.StatusBadRequest, constval.UserDeletedOrNotExist
+	}
+
+	token := utility.GenerateToken()
+	now := time.Now()
+	reset := &PasswordReset{
+		TokenHash: utility.HashToken(token),
+		UserID:    i.UserID,
+		IssuerID:  issuerID,
+		CreatedAt: now,
+		ExpiredAt: now.Add(passwordResetTTL),
+	}
+	if err := Db.Create(reset).Error; err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": i.UserID,
+			"err":     err,
+		}).Errorln("create password reset error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+
+	err := notify.GetSender().Send(notify.Message{
+		To:      user.Username,
+		Subject: "password reset",
+		Content: fmt.Sprintf("reset token: %s, expired at %s", token,
+			reset.ExpiredAt.Format("2006-01-02 15:04:05")),
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": i.UserID,
+			"err":     err,
+		}).Errorln("send password reset token error")
+		Db.Delete(reset)
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	return http.StatusOK, constval.OK
+}
+
+//used for resetting password by a reset token
+type ResetPasswordForm struct {
+	Token       string `json:"token" valid:"Required;Length(32)"`
+	NewPassword string `json:"new_password" valid:"Required;MinSize(8);MaxSize(20);PasswordCheck"`
+}
+
+func (r *ResetPasswordForm) ResetPassword() (int, constval.ErrNo) {
+	reset := &PasswordReset{}
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expired_at > ?", utility.HashToken(r.Token), time.Now()).
+			Limit(1).Find(reset)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		err := tx.Model(reset).Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return updatePassword(tx, reset.UserID, r.NewPassword)
+	})
+	if err != nil {
+		logger.GetInstance().WithField("err", err).Errorln("reset password error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if reset.UserID == 0 {
+		return http.StatusBadRequest, constval.ResetTokenInvalid
+	}
+
+	afterPasswordUpdated(reset.UserID)
+	return http.StatusOK, constval.OK
+}
+
+//passwords are managed by the directory when ldap authenticator is in use
+func localPasswordEnabled() bool {
+	_, ok := GetAuthenticator().(DbAuthenticator)
+	return ok
+}
+
+func updatePassword(tx *gorm.DB, userID uint64, password string) error {
+	return tx.Model(&User{}).Where("user_id = ?", userID).Update("password", password).Error
+}
+
+//password changed, all existing sessions must be invalidated
+func afterPasswordUpdated(userID uint64) {
+	if _, err := RevokeUserSessions(userID); err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": userID,
+			"err":     err,
+		}).Errorln("revoke sessions after password updated error")
+	}
+	invalidateUserCache(strconv.FormatUint(userID, 10))
+}
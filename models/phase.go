@@ -0,0 +1,229 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/cache"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+//group name: enrollment_phase	 key is term id and val is json of the phases of the term
+var maxEnrollmentPhaseCacheBytes int64 = 1024 * 1024
+
+//used for creating an enrollment phase, admin only
+type CreatePhaseForm struct {
+	TermID      uint64   `json:"term_id"` //0 means the current term
+	Name        string   `json:"name" valid:"Required;MaxSize(64)"`
+	StartAt     int64    `json:"start_at" valid:"Required"` //unix timestamp
+	EndAt       int64    `json:"end_at" valid:"Required"`   //unix timestamp
+	Grades      []int    `json:"grades"`                    //empty means all grades
+	Departments []string `json:"departments"`               //empty means all departments
+	MaxCredits  int      `json:"max_credits" valid:"Min(0)"`
+}
+
+func (c *CreatePhaseForm) CreatePhase(phase *EnrollmentPhase, actor Actor) (int, constval.ErrNo) {
+	if c.EndAt <= c.StartAt {
+		return http.StatusBadRequest, constval.ParamInvalid
+	}
+	grades := make([]string, len(c.Grades))
+	for i, grade := range c.Grades {
+		grades[i] = strconv.Itoa(grade)
+	}
+	for _, department := range c.Departments {
+		if department == "" || strings.Contains(department, ",") {
+			return http.StatusBadRequest, constval.ParamInvalid
+		}
+	}
+
+	termID, httpCode, errCode := resolveTermID(c.TermID)
+	if errCode != constval.OK {
+		return httpCode, errCode
+	}
+	term := &Term{}
+	result := Db.Where("term_id = ?", termID).Limit(1).Find(term)
+	if err := result.Error; err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"term_id": termID,
+			"err":     err,
+		}).Errorln("query term error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if result.RowsAffected == 0 {
+		return http.StatusBadRequest, constval.TermNotExist
+	}
+	if term.Status == TermArchived {
+		return http.StatusBadRequest, constval.TermStatusInvalid
+	}
+
+	*phase = EnrollmentPhase{
+		TermID:      termID,
+		Name:        c.Name,
+		StartAt:     time.Unix(c.StartAt, 0),
+		EndAt:       time.Unix(c.EndAt, 0),
+		Grades:      strings.Join(grades, ","),
+		Departments: strings.Join(c.Departments, ","),
+		MaxCredits:  c.MaxCredits,
+	}
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(phase).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, actor, AuditCreatePhase, AuditTargetTerm, strconv.FormatUint(termID, 10), nil, phase)
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"form": *c,
+			"err":  err,
+		}).Errorln("create enrollment phase error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	invalidatePhaseCache(termID)
+	return http.StatusOK, constval.OK
+}
+
+//used for deleting an enrollment phase, admin only
+type DeletePhaseForm struct {
+	PhaseID uint64 `json:"phase_id" valid:"Required"`
+}
+
+func (d *DeletePhaseForm) DeletePhase(actor Actor) (int, constval.ErrNo) {
+	phase := &EnrollmentPhase{}
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("phase_id = ?", d.PhaseID).Limit(1).Find(phase)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if err := tx.Delete(phase).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, actor, AuditDeletePhase, AuditTargetTerm, strconv.FormatUint(phase.TermID, 10),
+			phase, nil)
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"phase_id": d.PhaseID,
+			"err":      err,
+		}).Errorln("delete enrollment phase error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if phase.PhaseID == 0 {
+		return http.StatusBadRequest, constval.PhaseNotExist
+	}
+	invalidatePhaseCache(phase.TermID)
+	return http.StatusOK, constval.OK
+}
+
+//used for listing enrollment phases of a term
+type GetPhasesForm struct {
+	TermID uint64 `form:"term_id"` //0 means the current term
+}
+
+func (g *GetPhasesForm) GetPhases(phases *[]EnrollmentPhase) (int, constval.ErrNo) {
+	termID, httpCode, errCode := resolveTermID(g.TermID)
+	if errCode != constval.OK {
+		return httpCode, errCode
+	}
+	if err := termPhases(termID, phases); err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"term_id": termID,
+			"err":     err,
+		}).Errorln("get enrollment phases error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	return http.StatusOK, constval.OK
+}
+
+//whether a student with profile can book during the phase. A student without profile
+//is only eligible for phases without restriction
+func (e *EnrollmentPhase) eligible(profile *Profile) bool {
+	if e.Grades != "" && (profile == nil || !containsItem(e.Grades, strconv.Itoa(profile.Grade))) {
+		return false
+	}
+	if e.Departments != "" && (profile == nil || !containsItem(e.Departments, profile.Department)) {
+		return false
+	}
+	return true
+}
+
+//whether the comma separated list contains item
+func containsItem(list, item string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+//check whether the student can book courses of the term at now and fill in the current phase.
+//A term without phases is always open. Otherwise result.NextOpenAt is set to the start of
+//the student's next phase if any
+func (b BookCourseForm) checkPhase(termID uint64, now time.Time, current *EnrollmentPhase, result *BookResult) (int, constval.ErrNo) {
+	phases := []EnrollmentPhase{}
+	if err := termPhases(termID, &phases); err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"term_id": termID,
+			"err":     err,
+		}).Errorln("get enrollment phases error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if len(phases) == 0 {
+		return http.StatusOK, constval.OK
+	}
+
+	userInfo := UserInfo{}
+	httpCode, errCode := (&DelOrGetUserForm{UserID: b.UserID}).GetUserInfo(&userInfo)
+	if errCode == constval.UserDeletedOrNotExist {
+		return http.StatusBadRequest, constval.StudentNotExist
+	}
+	if errCode != constval.OK {
+		return httpCode, errCode
+	}
+
+	var nextOpenAt *time.Time
+	for i := range phases {
+		phase := &phases[i]
+		if !phase.eligible(userInfo.Profile) {
+			continue
+		}
+		if !now.Before(phase.StartAt) && now.Before(phase.EndAt) {
+			*current = *phase
+			return http.StatusOK, constval.OK
+		}
+		if phase.StartAt.After(now) && (nextOpenAt == nil || phase.StartAt.Before(*nextOpenAt)) {
+			nextOpenAt = &phase.StartAt
+		}
+	}
+	if nextOpenAt != nil {
+		ts := nextOpenAt.Unix()
+		result.NextOpenAt = &ts
+	}
+	return http.StatusBadRequest, constval.EnrollmentClosed
+}
+
+//load phases of a term from cache, order by start time
+func termPhases(termID uint64, phases *[]EnrollmentPhase) error {
+	phaseCache := cache.GetGroupCache("enrollment_phase")
+	if phaseCache == nil {
+		phaseCache = cache.NewGroupCache("enrollment_phase", maxEnrollmentPhaseCacheBytes,
+			cache.GetterFunc(EnrollmentPhaseGetter))
+	}
+	val, err := phaseCache.Get(strconv.FormatUint(termID, 10), cache.DefaultOption)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(val.ByteSlice(), phases)
+}
+
+func invalidatePhaseCache(termID uint64) {
+	if phaseCache := cache.GetGroupCache("enrollment_phase"); phaseCache != nil {
+		phaseCache.Del(strconv.FormatUint(termID, 10))
+	}
+}
@@ -0,0 +1,14 @@
+package models
+
+//attach profile to user info, the profile is left nil if the user has none
+func LoadProfile(userInfo *UserInfo) error {
+	profile := &Profile{}
+	result := Db.Where("user_id = ?", userInfo.UserID).Limit(1).Find(profile)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		userInfo.Profile = profile
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/cache"
+	"github.com/hollowdjj/course-selecting-sys/conf"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const purgeBatchSize = 100
+
+//start the background job which purges users deleted longer than the retention period.
+//All servers share one database, so the job only runs on the main host
+func StartPurgeJob() {
+	retention := conf.GetRetention()
+	if retention.UserDays <= 0 || conf.GetApp().Host != conf.GetApp().MainHost {
+		return
+	}
+	interval := time.Duration(retention.PurgeInterval) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			deadline := time.Now().AddDate(0, 0, -retention.UserDays)
+			purged, err := PurgeDeletedUsers(deadline)
+			if err != nil {
+				logger.GetInstance().WithField("err", err).Errorln("purge deleted users error")
+			} else if purged > 0 {
+				logger.GetInstance().WithField("purged", purged).Infoln("purge deleted users succ")
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+//users deleted before deactivated_at was added have no deactivation time and would never be
+//purged. The migration time is taken instead, so they are purged after the retention period
+func backfillDeactivatedAt() error {
+	return Db.Model(&User{}).Where("is_active = 0 AND deactivated_at IS NULL").
+		Update("deactivated_at", time.Now()).Error
+}
+
+//permanently delete users deactivated before deadline. Their enrollments are removed
+//and the seats are given back to the courses or their waitlists. Return the number of purged users
+func PurgeDeletedUsers(deadline time.Time) (int, error) {
+	purged := 0
+	for {
+		userIDs := []uint64{}
+		err := Db.Model(&User{}).Where("is_active = 0 AND deactivated_at < ?", deadline).
+			Order("user_id").Limit(purgeBatchSize).Pluck("user_id", &userIDs).Error
+		if err != nil {
+			return purged, err
+		}
+		for _, userID := range userIDs {
+			if err := purgeUser(userID, deadline); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+		if len(userIDs) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+//purge a user in one transaction
+func purgeUser(userID uint64, deadline time.Time) error {
+	user := &User{}
+	courseIDs := []uint64{}
+	promotedList := []*Waitlist{}
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		//the user may be restored since queried
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND is_active = 0 AND deactivated_at < ?", userID, deadline).Limit(1).Find(user)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		err := tx.Model(&StudentCourse{}).Where("student_id = ?", userID).Pluck("course_id", &courseIDs).Error
+		if err != nil {
+			return err
+		}
+		//seats held for the user on waitlists are freed as well
+		heldIDs := []uint64{}
+		err = tx.Model(&Waitlist{}).Where("student_id = ? AND status = ?", userID, WaitPromoted).
+			Pluck("course_id", &heldIDs).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Where("student_id = ?", userID).Delete(&Waitlist{}).Error; err != nil {
+			return err
+		}
+		if len(courseIDs) > 0 {
+			if err = tx.Where("student_id = ?", userID).Delete(&StudentCourse{}).Error; err != nil {
+				return err
+			}
+		}
+		courseIDs = append(courseIDs, heldIDs...)
+		for _, courseID := range courseIDs {
+			promoted, err := releaseSeat(tx, courseID)
+			if err != nil {
+				return err
+			}
+			if promoted != nil {
+				promotedList = append(promotedList, promoted)
+			}
+		}
+		//courses taught by a purged teacher become unbound
+		err = tx.Model(&Course{}).Where("teacher_id = ?", userID).Update("teacher_id", nil).Error
+		if err != nil {
+			return err
+		}
+		for _, v := range []interface{}{&Session{}, &PasswordReset{}, &Profile{}} {
+			if err = tx.Where("user_id = ?", userID).Delete(v).Error; err != nil {
+				return err
+			}
+		}
+		if err = tx.Delete(&User{}, userID).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, Actor{}, AuditPurgeUser, AuditTargetUser, strconv.FormatUint(userID, 10),
+			user.Info(), map[string]interface{}{"freed_courses": courseIDs})
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": userID,
+			"err":     err,
+		}).Errorln("purge user error")
+		return err
+	}
+	if user.UserID == 0 {
+		return nil
+	}
+
+	//the user row is gone, so the cache entries are dropped directly
+	key := strconv.FormatUint(userID, 10)
+	if groupCacheLogin := cache.GetGroupCache("login"); groupCacheLogin != nil {
+		groupCacheLogin.Del(user.Username)
+	}
+	if groupCacheUser := cache.GetGroupCache("user"); groupCacheUser != nil {
+		groupCacheUser.Del(key)
+	}
+	for _, courseID := range courseIDs {
+		invalidateEnrollmentCache(key, strconv.FormatUint(courseID, 10))
+	}
+	for _, promoted := range promotedList {
+		notifyPromoted(promoted)
+	}
+	return nil
+}
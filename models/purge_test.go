@@ -0,0 +1,88 @@
+package models
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+)
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	setupBookingDb(t)
+	course := newTestCourse(t, 10)
+	student := newTestStudents(t, 1)[0]
+	studentID, _ := strconv.ParseUint(student, 10, 64)
+	err := Db.Create(&StudentCourse{StudentID: studentID, CourseID: course.CourseID, TermID: course.TermID}).Error
+	if err == nil {
+		err = Db.Model(course).Update("remain_cap", course.RemainCap-1).Error
+	}
+	if err != nil {
+		t.Fatalf("enroll student error: %v", err)
+	}
+	//deleted before deactivated_at was added
+	if err = Db.Exec("UPDATE user SET is_active = 0, deactivated_at = NULL WHERE user_id = ?", student).Error; err != nil {
+		t.Fatalf("deactivate student error: %v", err)
+	}
+
+	if err = backfillDeactivatedAt(); err != nil {
+		t.Fatalf("backfill deactivated_at error: %v", err)
+	}
+	if _, err = PurgeDeletedUsers(time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("purge deleted users error: %v", err)
+	}
+	var users int64
+	if Db.Model(&User{}).Where("user_id = ?", student).Count(&users); users != 1 {
+		t.Fatalf("want the student kept within the retention period")
+	}
+
+	if _, err = PurgeDeletedUsers(time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("purge deleted users error: %v", err)
+	}
+	var enrollments int64
+	Db.Model(&User{}).Where("user_id = ?", student).Count(&users)
+	Db.Model(&StudentCourse{}).Where("student_id = ?", student).Count(&enrollments)
+	if users != 0 || enrollments != 0 {
+		t.Errorf("want the student and enrollments purged, got %d users and %d enrollments", users, enrollments)
+	}
+	if err = Db.First(course, course.CourseID).Error; err != nil {
+		t.Fatalf("query course error: %v", err)
+	}
+	if course.RemainCap != 10 {
+		t.Errorf("want the seat given back, got remain_cap %d", course.RemainCap)
+	}
+}
+
+func TestRestoreUser(t *testing.T) {
+	setupBookingDb(t)
+	student := newTestStudents(t, 1)[0]
+	del := &DelOrGetUserForm{UserID: student}
+	if _, errCode := del.DeleteUser(Actor{}); errCode != constval.OK {
+		t.Fatalf("delete user fail: %s", constval.GetErrCodeMsg(errCode))
+	}
+
+	//deleted members are only found by admins with include_inactive
+	admin := &UserInfo{UserType: int(Admin)}
+	get := &DelOrGetUserForm{UserID: student, IncludeInactive: true}
+	userInfo := &UserInfo{}
+	if _, errCode := get.GetMember(admin, userInfo); errCode != constval.OK || userInfo.IsActive != 0 {
+		t.Fatalf("want the deleted member found, got %s and is_active %d",
+			constval.GetErrCodeMsg(errCode), userInfo.IsActive)
+	}
+
+	userID := userInfo.UserID
+	restore := &RestoreUserForm{UserID: userID}
+	if _, errCode := restore.RestoreUser(Actor{}); errCode != constval.OK {
+		t.Fatalf("restore user fail: %s", constval.GetErrCodeMsg(errCode))
+	}
+	user := &User{}
+	if err := Db.First(user, userID).Error; err != nil {
+		t.Fatalf("query user error: %v", err)
+	}
+	if user.IsActive != 1 || user.DeactivatedAt != nil {
+		t.Errorf("want the user active without deactivated_at, got is_active %d", user.IsActive)
+	}
+	if _, errCode := restore.RestoreUser(Actor{}); errCode != constval.UserActiveOrNotExist {
+		t.Errorf("want an active user refused, got %s", constval.GetErrCodeMsg(errCode))
+	}
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//requirement which is not met
+const (
+	RequireDepartment   = "department"
+	RequireMinYear      = "min_year"
+	RequirePrerequisite = "prerequisite"
+)
+
+//result of checking requirements of a course for a student
+type Eligibility struct {
+	Eligible bool     `json:"eligible"`
+	Failed   string   `json:"failed,omitempty"`  //the first requirement not met
+	Missing  []string `json:"missing,omitempty"` //codes of prerequisites not completed
+}
+
+//used for setting requirements of a course, admin only. Old requirements are replaced
+type SetRequirementForm struct {
+	CourseID      uint64   `json:"course_id" valid:"Required"`
+	Prerequisites []string `json:"prerequisites"` //codes of courses
+	MinYear       int      `json:"min_year" valid:"Range(0,10)"`
+	Departments   []string `json:"departments"`
+}
+
+func (s *SetRequirementForm) SetRequirement(actor Actor) (int, constval.ErrNo) {
+	for _, list := range [][]string{s.Prerequisites, s.Departments} {
+		for _, item := range list {
+			if item == "" || len(item) > 64 || strings.Contains(item, ",") {
+				return http.StatusBadRequest, constval.ParamInvalid
+			}
+		}
+	}
+
+	course := &Course{}
+	requirement := &CourseRequirement{
+		CourseID:      s.CourseID,
+		Prerequisites: strings.Join(s.Prerequisites, ","),
+		MinYear:       s.MinYear,
+		Departments:   strings.Join(s.Departments, ","),
+	}
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("course_id").
+			Where("course_id = ?", s.CourseID).Limit(1).Find(course)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		before := &CourseRequirement{}
+		if err := tx.Where("course_id = ?", s.CourseID).Limit(1).Find(before).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(requirement).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, actor, AuditSetRequirement, AuditTargetCourse, strconv.FormatUint(s.CourseID, 10),
+			before, requirement)
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"course_id": s.CourseID,
+			"err":       err,
+		}).Errorln("set course requirement error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if course.CourseID == 0 {
+		return http.StatusBadRequest, constval.CourseNotExist
+	}
+	invalidateCourseCache(strconv.FormatUint(s.CourseID, 10))
+	return http.StatusOK, constval.OK
+}
+
+//used for checking whether a student meets requirements of a course without booking
+type CheckEligibilityForm struct {
+	UserID   string `form:"user_id" valid:"Required;Numeric"`
+	CourseID string `form:"course_id" valid:"Required;Numeric"`
+}
+
+func (c *CheckEligibilityForm) CheckEligibility(eligibility *Eligibility) (int, constval.ErrNo) {
+	course := &Course{}
+	if httpCode, errCode := (GetCourseForm{CourseID: c.CourseID}).GetCourseInfo(course); errCode != constval.OK {
+		return httpCode, errCode
+	}
+	return checkRequirement(c.UserID, course, eligibility)
+}
+
+//evaluate requirements of the course against profile and completed courses of the student
+func checkRequirement(studentID string, course *Course, eligibility *Eligibility) (int, constval.ErrNo) {
+	*eligibility = Eligibility{Eligible: true}
+	req := course.Requirement
+	if req == nil {
+		return http.StatusOK, constval.OK
+	}
+
+	userInfo := UserInfo{}
+	httpCode, errCode := (&DelOrGetUserForm{UserID: studentID}).GetUserInfo(&userInfo)
+	if errCode == constval.UserDeletedOrNotExist {
+		return http.StatusBadRequest, constval.StudentNotExist
+	}
+	if errCode != constval.OK {
+		return httpCode, errCode
+	}
+	profile := userInfo.Profile
+
+	if req.Departments != "" && (profile == nil || !containsItem(req.Departments, profile.Department)) {
+		*eligibility = Eligibility{Failed: RequireDepartment}
+		return http.StatusOK, constval.OK
+	}
+
+	if req.MinYear > 0 {
+		term := &Term{}
+		err := Db.Select("start_date").Where("term_id = ?", course.TermID).Limit(1).Find(term).Error
+		if err != nil {
+			logger.GetInstance().WithFields(logrus.Fields{
+				"term_id": course.TermID,
+				"err":     err,
+			}).Errorln("query term error")
+			return http.StatusInternalServerError, constval.UnknownError
+		}
+		if profile == nil || profile.Grade == 0 || yearOfStudy(profile.Grade, term.StartDate) < req.MinYear {
+			*eligibility = Eligibility{Failed: RequireMinYear}
+			return http.StatusOK, constval.OK
+		}
+	}
+
+	if req.Prerequisites != "" {
+		codes := strings.Split(req.Prerequisites, ",")
+		completed := []string{}
+		err := Db.Model(&StudentCourse{}).Distinct().
+			Joins("JOIN course ON course.course_id = student_course.course_id").
+			Joins("JOIN term ON term.term_id = course.term_id").
+			Where("student_course.student_id = ? AND term.status = ? AND course.code IN ?", studentID, TermArchived, codes).
+			Pluck("course.code", &completed).Error
+		if err != nil {
+			logger.GetInstance().WithFields(logrus.Fields{
+				"student_id": studentID,
+				"err":        err,
+			}).Errorln("query completed courses error")
+			return http.StatusInternalServerError, constval.UnknownError
+		}
+		done := make(map[string]bool, len(completed))
+		for _, code := range completed {
+			done[code] = true
+		}
+		for _, code := range codes {
+			if !done[code] {
+				eligibility.Missing = append(eligibility.Missing, code)
+			}
+		}
+		if len(eligibility.Missing) > 0 {
+			eligibility.Eligible, eligibility.Failed = false, RequirePrerequisite
+		}
+	}
+	return http.StatusOK, constval.OK
+}
+
+//year of study in a term, counted from the year of enrollment. Academic years start in august
+func yearOfStudy(grade int, termStart time.Time) int {
+	years := termStart.Year() - grade
+	if termStart.Month() >= time.August {
+		years++
+	}
+	return years
+}
@@ -3,7 +3,9 @@ package models
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
+	"github.com/astaxie/beego/validation"
 	"github.com/hollowdjj/course-selecting-sys/cache"
 	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
 	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
@@ -18,14 +20,96 @@ const (
 
 //used for creating course
 type CreateCourseForm struct {
-	Name string `form:"name" valid:"Required;MaxSize(255)"`
-	Cap  uint   `form:"cap" valid:"Required"`
+	Name      string `form:"name" valid:"MaxSize(255)"`
+	Code      string `form:"code" valid:"MaxSize(32)"`
+	Cap       uint   `form:"cap" valid:"Required"`
+	Credits   int    `form:"credits" valid:"Range(0, 20)"`
+	TermID    uint64 `form:"term_id"`    //0 means the current term
+	CatalogID uint64 `form:"catalog_id"` //0 means the catalog course is matched by code
+	Section   string `form:"section" valid:"MaxSize(16)"`
+	//metadata of the catalog course created without catalog_id
+	Department  string `form:"department" valid:"MaxSize(64)"`
+	Description string `form:"description" valid:"MaxSize(4096)"`
+	Language    string `form:"language" valid:"MaxSize(32)"`
+	Tags        string `form:"tags" valid:"MaxSize(255)"`
 }
 
-//create course if not exist
+func (c *CreateCourseForm) Valid(v *validation.Validation) {
+	if c.CatalogID != 0 {
+		return
+	}
+	if c.Name == "" {
+		v.SetError("name", "name or catalog_id is required")
+	}
+}
+
+//create a section of a catalog course in a term if not exist. Without catalog_id, the catalog
+//course is matched by code, or by name if code is not given, and created if not found. Section is
+//unique per catalog course in a term
 func (c CreateCourseForm) CreateCourse(course *Course) (int, constval.ErrNo) {
-	result := Db.FirstOrCreate(course)
+	termID, httpCode, errCode := resolveTermID(c.TermID)
+	if errCode != constval.OK {
+		return httpCode, errCode
+	}
+	term := &Term{}
+	result := Db.Where("term_id = ?", termID).Limit(1).Find(term)
 	if err := result.Error; err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"term_id": termID,
+			"err":     err,
+		}).Errorln("query term error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if result.RowsAffected == 0 {
+		return http.StatusBadRequest, constval.TermNotExist
+	}
+	if term.Status == TermArchived {
+		return http.StatusBadRequest, constval.TermStatusInvalid
+	}
+
+	errCode = constval.OK
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		catalog := &CatalogCourse{}
+		if c.CatalogID != 0 {
+			result := tx.Where("catalog_id = ?", c.CatalogID).Limit(1).Find(catalog)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				errCode = constval.CatalogNotExist
+				return nil
+			}
+		} else {
+			*catalog = CreateCatalogForm{Name: c.Name, Code: c.Code, Credits: c.Credits, Department: c.Department,
+				Description: c.Description, Language: c.Language, Tags: c.Tags}.catalog()
+			if _, err := findOrCreateCatalog(tx, catalog); err != nil {
+				return err
+			}
+		}
+
+		course.CatalogID, course.Section, course.TermID = catalog.CatalogID, c.Section, termID
+		course.CourseName, course.Code, course.Credits = catalog.CourseName, catalog.Code, catalog.Credits
+		result := tx.Where("catalog_id = ? AND term_id = ? AND section = ?", catalog.CatalogID, termID, c.Section).
+			FirstOrCreate(course)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			errCode = constval.SectionExisted
+			if c.Section == "" {
+				errCode = constval.CourseExisted
+			}
+		}
+		return nil
+	})
+	if isDuplicateKey(err) {
+		//created by a concurrent request
+		err, errCode = nil, constval.SectionExisted
+		if c.Section == "" {
+			errCode = constval.CourseExisted
+		}
+	}
+	if err != nil {
 		logger.GetInstance().WithFields(logrus.Fields{
 			"name": c.Name,
 			"cap":  c.Cap,
@@ -33,12 +117,14 @@ func (c CreateCourseForm) CreateCourse(course *Course) (int, constval.ErrNo) {
 		}).Errorln("create course error")
 		return http.StatusInternalServerError, constval.UnknownError
 	}
-	if result.RowsAffected == 0 {
+	if errCode != constval.OK {
 		logger.GetInstance().WithFields(logrus.Fields{
-			"name": c.Name,
-			"cap":  c.Cap,
-		}).Errorln("course already exist")
-		return http.StatusBadRequest, constval.CourseExisted
+			"name":       c.Name,
+			"catalog_id": c.CatalogID,
+			"section":    c.Section,
+			"msg":        constval.GetErrCodeMsg(errCode),
+		}).Infoln("create course fail")
+		return http.StatusBadRequest, errCode
 	}
 	return http.StatusOK, constval.OK
 }
@@ -85,7 +171,7 @@ type BindCourseForm struct {
 	TeacherID string `form:"teacher_id" valid:"Required"`
 }
 
-func (b BindCourseForm) BindCourse() (int, constval.ErrNo) {
+func (b BindCourseForm) BindCourse(actor Actor) (int, constval.ErrNo) {
 	course := &Course{}
 	err := Db.Transaction(func(tx *gorm.DB) error {
 		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("teacher_id").
@@ -102,8 +188,12 @@ func (b BindCourseForm) BindCourse() (int, constval.ErrNo) {
 			return err
 		}
 
-		return nil
+		return writeAudit(tx, actor, AuditBindCourse, AuditTargetCourse, b.CourseID,
+			map[string]interface{}{"teacher_id": nil}, map[string]interface{}{"teacher_id": b.TeacherID})
 	})
+	if err == gorm.ErrRecordNotFound {
+		return http.StatusBadRequest, constval.CourseNotExist
+	}
 	if err != nil {
 		logger.GetInstance().WithFields(logrus.Fields{
 			"course_id":  b.CourseID,
@@ -120,28 +210,39 @@ func (b BindCourseForm) BindCourse() (int, constval.ErrNo) {
 		}).Infoln("course has been bound")
 		return http.StatusOK, constval.CourseHasBound
 	}
+	invalidateCourseCache(b.CourseID)
 	return http.StatusOK, constval.OK
 }
 
-func (b BindCourseForm) UnBindCourse() (int, constval.ErrNo) {
+func (b BindCourseForm) UnBindCourse(actor Actor) (int, constval.ErrNo) {
 	course := &Course{}
+	errCode := constval.OK
 	err := Db.Transaction(func(tx *gorm.DB) error {
 		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("teacher_id").
 			Where("course_id = ?", b.CourseID).First(course).Error
 		if err != nil {
 			return err
 		}
-		if course.TeacherID != nil {
+		if course.TeacherID == nil {
+			errCode = constval.CourseNotBind
+			return nil
+		}
+		if strconv.FormatUint(*course.TeacherID, 10) != b.TeacherID {
+			errCode = constval.UnBindError
 			return nil
 		}
 		err = tx.Model(&Course{}).Select("teacher_id").Where("course_id = ?", b.CourseID).
-			Update("teacher_id", 0).Error
+			Update("teacher_id", nil).Error
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return writeAudit(tx, actor, AuditUnBindCourse, AuditTargetCourse, b.CourseID,
+			map[string]interface{}{"teacher_id": b.TeacherID}, map[string]interface{}{"teacher_id": nil})
 	})
+	if err == gorm.ErrRecordNotFound {
+		return http.StatusBadRequest, constval.CourseNotExist
+	}
 	if err != nil {
 		logger.GetInstance().WithFields(logrus.Fields{
 			"course_id":  b.CourseID,
@@ -151,23 +252,52 @@ func (b BindCourseForm) UnBindCourse() (int, constval.ErrNo) {
 		return http.StatusInternalServerError, constval.UnknownError
 	}
 
-	if course.TeacherID != nil {
+	if errCode != constval.OK {
 		logger.GetInstance().WithFields(logrus.Fields{
 			"course_id":  b.CourseID,
 			"teacher_id": course.TeacherID,
-		}).Infoln("course has been bound")
-		return http.StatusOK, constval.CourseHasBound
+			"msg":        constval.GetErrCodeMsg(errCode),
+		}).Infoln("course can not be unbound")
+		return http.StatusOK, errCode
 	}
+	invalidateCourseCache(b.CourseID)
 	return http.StatusOK, constval.OK
 }
 
+//drop cached course info so that the latest course is loaded on next query
+func invalidateCourseCache(courseID string) {
+	if courseInfoCache := cache.GetGroupCache("course_info"); courseInfoCache != nil {
+		courseInfoCache.Del(courseID)
+	}
+}
+
 //used for getting teacher courses
 type GetTeacherCourseForm struct {
 	TeacherID uint64 `form:"teacher_id" valid:"Required"`
+	TermID    uint64 `form:"term_id"` //0 means the current term
+	Cursor    string `form:"cursor" valid:"MaxSize(512)"`
+	Limit     int    `form:"limit" valid:"Min(0)"`
+}
+
+//fill in the current term if term is not set
+func (g *GetTeacherCourseForm) ResolveTerm() (int, constval.ErrNo) {
+	termID, httpCode, errCode := resolveTermID(g.TermID)
+	g.TermID = termID
+	return httpCode, errCode
 }
 
-func (g GetTeacherCourseForm) GetTeacherCourses(courses *[]Course) (int, constval.ErrNo) {
-	result := Db.Model(&Course{}).Where("teacher_id = ?", g.TeacherID).Find(courses)
+func (g GetTeacherCourseForm) GetTeacherCourses(courses *[]Course, page *Page) (int, constval.ErrNo) {
+	if httpCode, errCode := g.ResolveTerm(); errCode != constval.OK {
+		return httpCode, errCode
+	}
+	k := keyset{pk: "course_id", sort: "course_id", limit: pageSize(g.Limit)}
+	cursor, err := decodeCursor(g.Cursor, k.pk, k.sort)
+	if err != nil {
+		return http.StatusBadRequest, constval.ParamInvalid
+	}
+	k.cursor = cursor
+
+	result := k.apply(Db.Model(&Course{}).Where("teacher_id = ? AND term_id = ?", g.TeacherID, g.TermID)).Find(courses)
 	if err := result.Error; err != nil && err != gorm.ErrRecordNotFound {
 		logger.GetInstance().WithFields(logrus.Fields{
 			"teacher_id": g.TeacherID,
@@ -175,9 +305,12 @@ func (g GetTeacherCourseForm) GetTeacherCourses(courses *[]Course) (int, constva
 		}).Errorln("query teacher course error")
 		return http.StatusInternalServerError, constval.UnknownError
 	}
-	if result.RowsAffected == 0 {
+	if result.RowsAffected == 0 && k.cursor == nil {
 		logger.GetInstance().WithField("teacher_id", g.TeacherID).Infoln("query teacher course empty")
 		return http.StatusOK, constval.TeacherHasNoCourse
 	}
+	*page = k.page(courses, func(i int) (uint64, string) {
+		return (*courses)[i].CourseID, ""
+	})
 	return http.StatusOK, constval.OK
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/astaxie/beego/validation"
+)
+
+func TestCreateCourseFormValid(t *testing.T) {
+	for _, tc := range []struct {
+		form  CreateCourseForm
+		valid bool
+	}{
+		{CreateCourseForm{Name: "Algebra", Code: "MATH101", Cap: 30}, true},
+		{CreateCourseForm{Name: "Algebra", Cap: 30}, true}, //code is generated
+		{CreateCourseForm{CatalogID: 1, Cap: 30}, true},
+		{CreateCourseForm{Code: "MATH101", Cap: 30}, false},
+	} {
+		valid := validation.Validation{}
+		ok, err := valid.Valid(&tc.form)
+		if err != nil || ok != tc.valid {
+			t.Errorf("form %+v: want valid %v, got %v (%v)", tc.form, tc.valid, ok, err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/cache"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+//generate a token for user, persist its hash to table session and add it to session cache
+func CreateSession(userInfo UserInfo, clientIP, userAgent string) (string, error) {
+	now := time.Now()
+	token := utility.GenerateToken()
+	session := &Session{
+		TokenHash: utility.HashToken(token),
+		UserID:    userInfo.UserID,
+		ClientIP:  clientIP,
+		UserAgent: userAgent,
+		CreatedAt: now,
+		ExpiredAt: now.Add(loginCacheTTL * time.Second),
+	}
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		//clean up expired sessions of this user by the way
+		err := tx.Where("user_id = ? AND expired_at <= ?", userInfo.UserID, now).Delete(&Session{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(session).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(userInfo)
+	if err != nil {
+		return "", err
+	}
+	groupCacheSession := cache.GetGroupCache("session")
+	if groupCacheSession == nil {
+		groupCacheSession = cache.NewGroupCache("session", loginCacheMaxBytes, cache.GetterFunc(SessionGetter))
+	}
+	groupCacheSession.Add(session.TokenHash, data, loginCacheTTL)
+	return token, nil
+}
+
+//query session table when the token is not found in local session cache
+func getUserInfoBySession(tokenHash string, userInfo *UserInfo) (int, constval.ErrNo) {
+	session := &Session{}
+	result := Db.Where("token_hash = ? AND expired_at > ?", tokenHash, time.Now()).Limit(1).Find(session)
+	if err := result.Error; err != nil {
+		logger.GetInstance().WithField("err", err).Errorln("query session error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if result.RowsAffected == 0 {
+		return http.StatusUnauthorized, constval.LoginRequired
+	}
+
+	result = Db.Model(&User{}).Where("user_id = ? AND is_active = 1", session.UserID).Limit(1).Find(userInfo)
+	if err := result.Error; err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": session.UserID,
+			"err":     err,
+		}).Errorln("query session user error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if result.RowsAffected == 0 {
+		return http.StatusUnauthorized, constval.LoginRequired
+	}
+	return http.StatusOK, constval.OK
+}
+
+//delete a session by token, used for logout
+func RevokeToken(token string) error {
+	return revokeSession(utility.HashToken(token))
+}
+
+//delete a session by the hash of its token
+func revokeSession(tokenHash string) error {
+	err := Db.Where("token_hash = ?", tokenHash).Delete(&Session{}).Error
+	if err != nil {
+		return err
+	}
+	if groupCacheSession := cache.GetGroupCache("session"); groupCacheSession != nil {
+		groupCacheSession.Del(tokenHash)
+	}
+	return nil
+}
+
+//delete all sessions of user and return the number of revoked sessions
+func RevokeUserSessions(userID uint64) (int64, error) {
+	sessions := []Session{}
+	var revoked int64
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Select("token_hash").Where("user_id = ?", userID).Find(&sessions).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Where("user_id = ?", userID).Delete(&Session{})
+		revoked = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if groupCacheSession := cache.GetGroupCache("session"); groupCacheSession != nil {
+		for i := range sessions {
+			groupCacheSession.Del(sessions[i].TokenHash)
+		}
+	}
+	return revoked, nil
+}
+
+//get all active sessions of user, the session which owns currToken is marked as current
+func GetUserSessions(userID uint64, currToken string, sessions *[]Session) (int, constval.ErrNo) {
+	err := Db.Where("user_id = ? AND expired_at > ?", userID, time.Now()).
+		Order("created_at DESC").Find(sessions).Error
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": userID,
+			"err":     err,
+		}).Errorln("query user sessions error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	currHash := utility.HashToken(currToken)
+	for i := range *sessions {
+		(*sessions)[i].Current = (*sessions)[i].TokenHash == currHash
+	}
+	return http.StatusOK, constval.OK
+}
+
+//used for revoking one session of current user
+type RevokeSessionForm struct {
+	SessionID uint64 `json:"session_id" valid:"Required"`
+}
+
+func (r *RevokeSessionForm) RevokeSession(userID uint64) (int, constval.ErrNo) {
+	session := &Session{}
+	result := Db.Select("token_hash").Where("session_id = ? AND user_id = ?", r.SessionID, userID).
+		Limit(1).Find(session)
+	if err := result.Error; err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"session_id": r.SessionID,
+			"err":        err,
+		}).Errorln("query session error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if result.RowsAffected == 0 {
+		return http.StatusBadRequest, constval.SessionNotExist
+	}
+
+	if err := revokeSession(session.TokenHash); err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"session_id": r.SessionID,
+			"err":        err,
+		}).Errorln("revoke session error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	return http.StatusOK, constval.OK
+}
+
+//used for revoking all sessions of a user, admin only
+type RevokeAllSessionsForm struct {
+	UserID uint64 `json:"user_id" valid:"Required"`
+}
+
+func (r *RevokeAllSessionsForm) RevokeAllSessions(revoked *int64) (int, constval.ErrNo) {
+	n, err := RevokeUserSessions(r.UserID)
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": r.UserID,
+			"err":     err,
+		}).Errorln("revoke user sessions error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	*revoked = n
+	return http.StatusOK, constval.OK
+}
+
+//sessions used to store the token itself. Hash the tokens of live sessions in place, so that users
+//stay logged in, and drop the plaintext column
+func hashSessionTokens() error {
+	if !Db.Migrator().HasColumn(&Session{}, "token") {
+		return nil
+	}
+	err := Db.Exec("UPDATE session SET token_hash = SHA2(token, 256) WHERE token_hash IS NULL OR token_hash = ''").Error
+	if err != nil {
+		return err
+	}
+	return Db.Migrator().DropColumn(&Session{}, "token")
+}
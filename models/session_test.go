@@ -0,0 +1,44 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
+)
+
+func TestSessionToken(t *testing.T) {
+	setupBookingDb(t)
+	student := newTestStudents(t, 1)[0]
+	user := &User{}
+	if err := Db.Where("user_id = ?", student).First(user).Error; err != nil {
+		t.Fatalf("query student error: %v", err)
+	}
+	token, err := CreateSession(user.Info(), "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("create session error: %v", err)
+	}
+
+	//only the hash is stored
+	var stored int64
+	Db.Model(&Session{}).Where("token_hash = ?", utility.HashToken(token)).Count(&stored)
+	if stored != 1 {
+		t.Errorf("want the hash of the token stored, got %d sessions", stored)
+	}
+	userInfo := &UserInfo{}
+	if _, errCode := GetUserInfoByToken(token, userInfo); errCode != constval.OK || userInfo.UserID != user.UserID {
+		t.Fatalf("want the token resolved to user %d, got %s", user.UserID, constval.GetErrCodeMsg(errCode))
+	}
+	for _, bad := range []string{user.Username, utility.HashToken(token)} {
+		if _, errCode := GetUserInfoByToken(bad, &UserInfo{}); errCode != constval.LoginRequired {
+			t.Errorf("want %q refused as a token, got %s", bad, constval.GetErrCodeMsg(errCode))
+		}
+	}
+
+	if err = RevokeToken(token); err != nil {
+		t.Fatalf("revoke token error: %v", err)
+	}
+	if _, errCode := GetUserInfoByToken(token, &UserInfo{}); errCode != constval.LoginRequired {
+		t.Errorf("want a revoked token refused, got %s", constval.GetErrCodeMsg(errCode))
+	}
+}
@@ -1,14 +1,26 @@
 package models
 
+import (
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/timetable"
+)
+
 //user type
 type UserType int
 
 const (
-	Admin UserType = iota
+	Admin UserType = iota + 1 //keep in line with CreateUserForm.UserType which ranges from 1 to 3
 	Student
 	Teacher
 )
 
+//where a user signs in
+const (
+	AuthSourceLocal = "local" //password stored in table user
+	AuthSourceLdap  = "ldap"  //provisioned by the first ldap login
+)
+
 //table user
 type User struct {
 	UserID   uint64 `gorm:"primaryKey" json:"user_id"`
@@ -17,27 +29,194 @@ type User struct {
 	Nickname string `json:"nickname"`
 	UserType int    `json:"user_type"`
 	IsActive int    `json:"is_active" gorm:"default:1"`
+	//when the user was deactivated, deactivated users are purged after the retention period
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+	//where the user signs in, local users are never taken over by directory logins
+	AuthSource string `json:"auth_source" gorm:"size:16;default:local"`
+}
+
+//user info without password
+func (u User) Info() UserInfo {
+	return UserInfo{
+		UserID:   u.UserID,
+		UserType: u.UserType,
+		Username: u.Username,
+		Nickname: u.Nickname,
+		IsActive: u.IsActive,
+	}
 }
 
 //query user info
 type UserInfo struct {
-	UserID   uint64 `json:"user_id"`
-	UserType int    `json:"user_type"`
-	Username string `json:"username"`
-	Nickname string `json:"nickname"`
+	UserID   uint64   `json:"user_id"`
+	UserType int      `json:"user_type"`
+	Username string   `json:"username"`
+	Nickname string   `json:"nickname"`
+	IsActive int      `json:"is_active"`
+	Profile  *Profile `json:"profile,omitempty" gorm:"-"` //only loaded for single user queries
 }
 
-//table course
+//table profile. Extended member info, at most one row per user
+type Profile struct {
+	UserID     uint64    `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	Number     string    `gorm:"size:32;index" json:"number"` //student number or staff number
+	Department string    `gorm:"size:64;index" json:"department"`
+	Grade      int       `gorm:"index" json:"grade"` //year of enrollment, 0 means unknown
+	Email      string    `gorm:"size:128" json:"email"`
+	Phone      string    `gorm:"size:32" json:"phone"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+//table course. A section of a catalog course offered in a term. Name, code and credits are
+//copied from the catalog course when the section is created. Catalog course, term and section
+//are unique together by uk_course_section, which is created in migrate
 type Course struct {
-	CourseID    uint64  `gorm:"primaryKey" json:"course_id"`
-	CourseName  string  `json:"course_name"`
-	Cap         uint    `json:"cap"`
-	RemainCap   uint    `json:"remain_cap"`
-	TeacherID   *uint64 `json:"teacher_id"`
-	TeacherName *string `json:"teacher_name"`
+	CourseID    uint64             `gorm:"primaryKey" json:"course_id"`
+	CatalogID   uint64             `gorm:"index" json:"catalog_id"`
+	Section     string             `gorm:"size:16" json:"section"` //section number within the catalog course and term
+	CourseName  string             `json:"course_name"`
+	Code        string             `gorm:"size:32;index" json:"code"` //catalog code, the same across terms
+	Cap         uint               `json:"cap"`
+	RemainCap   uint               `json:"remain_cap"`
+	TeacherID   *uint64            `json:"teacher_id"`
+	TeacherName *string            `json:"teacher_name"`
+	TermID      uint64             `gorm:"index" json:"term_id"`
+	Credits     uint               `json:"credits"`
+	Slots       []CourseSlot       `gorm:"foreignKey:CourseID" json:"slots,omitempty"`
+	Requirement *CourseRequirement `gorm:"foreignKey:CourseID" json:"requirement,omitempty"`
+	Catalog     *CatalogCourse     `json:"catalog,omitempty"` //belongs to the catalog course by CatalogID
 }
 
+//table catalog_course. A course in the catalog, offered as one or more sections in each term
+type CatalogCourse struct {
+	CatalogID   uint64    `gorm:"primaryKey" json:"catalog_id"`
+	CourseName  string    `gorm:"index:idx_catalog_course_text,class:FULLTEXT,option:WITH PARSER ngram" json:"course_name"`
+	Code        string    `gorm:"size:32;uniqueIndex:uk_catalog_course_code" json:"code"`
+	Credits     uint      `json:"credits"`
+	Department  string    `gorm:"size:64;index" json:"department"` //department offering the course
+	Description string    `gorm:"type:text;index:idx_catalog_course_text,class:FULLTEXT,option:WITH PARSER ngram" json:"description"`
+	Language    string    `gorm:"size:32;index" json:"language"` //language of instruction
+	Tags        string    `gorm:"size:255" json:"tags"`          //comma separated free-form tags
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+//table course_requirement. Eligibility rules of a course checked at booking time
+type CourseRequirement struct {
+	CourseID      uint64 `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	Prerequisites string `json:"prerequisites"` //comma separated codes of courses which must be completed
+	MinYear       int    `json:"min_year"`      //minimum year of study, 0 means no limit
+	Departments   string `json:"departments"`   //comma separated, empty means all
+}
+
+//table course_slot. Weekly meeting time and place of a course
+type CourseSlot struct {
+	SlotID   uint64 `gorm:"primaryKey" json:"slot_id"`
+	CourseID uint64 `gorm:"index" json:"course_id"`
+	timetable.Slot
+	Location string `gorm:"size:64" json:"location"`
+}
+
+//table student_course. A student books a course at most once
 type StudentCourse struct {
-	StudentID uint64 `json:"student_id"`
-	CourseID  uint64 `json:"course_id"`
+	StudentID uint64 `gorm:"uniqueIndex:uk_student_course,priority:1" json:"student_id"`
+	CourseID  uint64 `gorm:"uniqueIndex:uk_student_course,priority:2" json:"course_id"`
+	TermID    uint64 `gorm:"index" json:"term_id"`
+}
+
+//table term. Courses and enrollments belong to a term, at most one term is open at a time
+type Term struct {
+	TermID    uint64    `gorm:"primaryKey" json:"term_id"`
+	Name      string    `gorm:"uniqueIndex;size:64" json:"name"`
+	StartDate time.Time `gorm:"type:date" json:"start_date"`
+	EndDate   time.Time `gorm:"type:date" json:"end_date"`
+	Status    string    `gorm:"size:16;index" json:"status"`
+	//credit load of a student in the term, 0 max means no limit
+	MinCredits   uint       `json:"min_credits"`
+	MaxCredits   uint       `json:"max_credits"`
+	DropDeadline *time.Time `json:"drop_deadline"` //courses can not be dropped after it, nil means no deadline
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+//table credit_limit. Credit load of a student in a term set by admin, overrides limits of the term
+type CreditLimit struct {
+	StudentID  uint64 `gorm:"primaryKey;autoIncrement:false" json:"student_id"`
+	TermID     uint64 `gorm:"primaryKey;autoIncrement:false" json:"term_id"`
+	MinCredits uint   `json:"min_credits"`
+	MaxCredits uint   `json:"max_credits"` //0 means no limit
+}
+
+//table session. One row per login token, used for listing and revoking sessions
+type Session struct {
+	SessionID uint64    `gorm:"primaryKey" json:"session_id"`
+	TokenHash string    `gorm:"uniqueIndex;size:64" json:"-"` //sha256 of the token, the token itself is not stored
+	UserID    uint64    `gorm:"index" json:"user_id"`
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiredAt time.Time `json:"expired_at"`
+	Current   bool      `gorm:"-" json:"current"`
+}
+
+//table password_reset. Token is stored hashed and can be used only once
+type PasswordReset struct {
+	ResetID   uint64     `gorm:"primaryKey" json:"reset_id"`
+	TokenHash string     `gorm:"uniqueIndex;size:64" json:"-"`
+	UserID    uint64     `gorm:"index" json:"user_id"`
+	IssuerID  uint64     `json:"issuer_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiredAt time.Time  `json:"expired_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+//table api_key. Service credential for machine-to-machine access, the key is stored hashed
+type ApiKey struct {
+	KeyID      uint64     `gorm:"primaryKey" json:"key_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `gorm:"uniqueIndex;size:64" json:"-"`
+	Scopes     string     `json:"scopes"` //comma separated, such as member:create,course:create
+	OwnerID    uint64     `json:"owner_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiredAt  *time.Time `json:"expired_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+//table audit_log. Append-only, written in the same transaction as the mutation
+type AuditLog struct {
+	AuditID    uint64    `gorm:"primaryKey" json:"audit_id"`
+	ActorID    uint64    `gorm:"index" json:"actor_id"`
+	Action     string    `gorm:"index;size:64" json:"action"`
+	TargetType string    `gorm:"index:idx_audit_target;size:32" json:"target_type"`
+	TargetID   string    `gorm:"index:idx_audit_target;size:64" json:"target_id"`
+	Before     string    `gorm:"type:text" json:"before"`
+	After      string    `gorm:"type:text" json:"after"`
+	RequestID  string    `gorm:"size:64" json:"request_id"`
+	ClientIP   string    `gorm:"size:64" json:"client_ip"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
+//table enrollment_phase. Students can only book courses of a term during a phase they are eligible for
+type EnrollmentPhase struct {
+	PhaseID     uint64    `gorm:"primaryKey" json:"phase_id"`
+	TermID      uint64    `gorm:"index" json:"term_id"`
+	Name        string    `json:"name"`
+	StartAt     time.Time `json:"start_at"`
+	EndAt       time.Time `json:"end_at"`
+	Grades      string    `json:"grades"`      //comma separated years of enrollment, empty means all
+	Departments string    `json:"departments"` //comma separated, empty means all
+	MaxCredits  int       `json:"max_credits"` //0 means no limit of this phase
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+//table waitlist. Students waiting for a seat of a full course, served in order of wait_id
+type Waitlist struct {
+	WaitID     uint64     `gorm:"primaryKey" json:"wait_id"`
+	CourseID   uint64     `gorm:"index:idx_waitlist_course_status" json:"course_id"`
+	StudentID  uint64     `gorm:"index" json:"student_id"`
+	Status     string     `gorm:"size:16;index:idx_waitlist_course_status" json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	PromotedAt *time.Time `json:"promoted_at"`
+	ClaimUntil *time.Time `gorm:"index" json:"claim_until"` //the held seat is released after it
+	Position   int64      `gorm:"-" json:"position,omitempty"`
 }
@@ -0,0 +1,262 @@
+package models
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/cache"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//term status. A term goes from planned to open to archived
+const (
+	TermPlanned  = "planned"
+	TermOpen     = "open"
+	TermArchived = "archived"
+)
+
+const (
+	termDateLayout = "2006-01-02"
+	//group name: term	 the only key is current and val is the id of the open term
+	maxTermCacheBytes int64 = 1024
+	currentTermKey          = "current"
+)
+
+//used for creating a term, admin only
+type CreateTermForm struct {
+	Name      string `json:"name" valid:"Required;MaxSize(64)"`
+	StartDate string `json:"start_date" valid:"Required;Match(/^\\d{4}-\\d{2}-\\d{2}$/)"`
+	EndDate   string `json:"end_date" valid:"Required;Match(/^\\d{4}-\\d{2}-\\d{2}$/)"`
+	//credit load of a student, 0 max means no limit
+	MinCredits   uint  `json:"min_credits"`
+	MaxCredits   uint  `json:"max_credits"`
+	DropDeadline int64 `json:"drop_deadline" valid:"Min(0)"` //unix timestamp, 0 means no deadline
+}
+
+func (c *CreateTermForm) CreateTerm(term *Term, actor Actor) (int, constval.ErrNo) {
+	startDate, err1 := time.ParseInLocation(termDateLayout, c.StartDate, time.Local)
+	endDate, err2 := time.ParseInLocation(termDateLayout, c.EndDate, time.Local)
+	if err1 != nil || err2 != nil || !endDate.After(startDate) {
+		return http.StatusBadRequest, constval.ParamInvalid
+	}
+	if c.MaxCredits > 0 && c.MinCredits > c.MaxCredits {
+		return http.StatusBadRequest, constval.ParamInvalid
+	}
+
+	*term = Term{
+		Name:       c.Name,
+		StartDate:  startDate,
+		EndDate:    endDate,
+		Status:     TermPlanned,
+		MinCredits: c.MinCredits,
+		MaxCredits: c.MaxCredits,
+	}
+	if c.DropDeadline > 0 {
+		dropDeadline := time.Unix(c.DropDeadline, 0)
+		term.DropDeadline = &dropDeadline
+	}
+	var created int64
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where(Term{Name: c.Name}).FirstOrCreate(term)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		created = result.RowsAffected
+		return writeAudit(tx, actor, AuditCreateTerm, AuditTargetTerm, strconv.FormatUint(term.TermID, 10),
+			nil, term)
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"name": c.Name,
+			"err":  err,
+		}).Errorln("create term error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if created == 0 {
+		return http.StatusBadRequest, constval.TermExisted
+	}
+	return http.StatusOK, constval.OK
+}
+
+//used for opening or archiving a term, admin only
+type TermStatusForm struct {
+	TermID uint64 `json:"term_id" valid:"Required"`
+}
+
+//open a planned term, which becomes the current term
+func (t *TermStatusForm) OpenTerm(actor Actor) (int, constval.ErrNo) {
+	return t.setStatus(TermOpen, []string{TermPlanned}, AuditOpenTerm, actor)
+}
+
+//archive a planned or open term
+func (t *TermStatusForm) ArchiveTerm(actor Actor) (int, constval.ErrNo) {
+	return t.setStatus(TermArchived, []string{TermPlanned, TermOpen}, AuditArchiveTerm, actor)
+}
+
+func (t *TermStatusForm) setStatus(status string, from []string, action string, actor Actor) (int, constval.ErrNo) {
+	term := &Term{}
+	errCode := constval.OK
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("term_id = ?", t.TermID).Limit(1).Find(term)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			errCode = constval.TermNotExist
+			return nil
+		}
+		allowed := false
+		for _, s := range from {
+			allowed = allowed || term.Status == s
+		}
+		if !allowed {
+			errCode = constval.TermStatusInvalid
+			return nil
+		}
+		if status == TermOpen {
+			var opened int64
+			err := tx.Model(&Term{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("status = ?", TermOpen).Count(&opened).Error
+			if err != nil {
+				return err
+			}
+			if opened > 0 {
+				errCode = constval.TermOpenExisted
+				return nil
+			}
+		}
+
+		before := term.Status
+		if err := tx.Model(term).Update("status", status).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, actor, action, AuditTargetTerm, strconv.FormatUint(t.TermID, 10),
+			map[string]interface{}{"status": before}, map[string]interface{}{"status": status})
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"term_id": t.TermID,
+			"status":  status,
+			"err":     err,
+		}).Errorln("update term status error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if errCode != constval.OK {
+		return http.StatusBadRequest, errCode
+	}
+	if termCache := cache.GetGroupCache("term"); termCache != nil {
+		termCache.Del(currentTermKey)
+	}
+	return http.StatusOK, constval.OK
+}
+
+//list all terms, the latest first
+func GetTerms(terms *[]Term) (int, constval.ErrNo) {
+	if err := Db.Order("start_date DESC").Find(terms).Error; err != nil {
+		logger.GetInstance().WithField("err", err).Errorln("query terms error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	return http.StatusOK, constval.OK
+}
+
+//get the open term
+func GetCurrentTerm(term *Term) (int, constval.ErrNo) {
+	termID, httpCode, errCode := resolveTermID(0)
+	if errCode != constval.OK {
+		return httpCode, errCode
+	}
+	result := Db.Where("term_id = ?", termID).Limit(1).Find(term)
+	if err := result.Error; err != nil {
+		logger.GetInstance().WithField("err", err).Errorln("query current term error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if result.RowsAffected == 0 {
+		return http.StatusBadRequest, constval.NoCurrentTerm
+	}
+	return http.StatusOK, constval.OK
+}
+
+//id of the open term, 0 means no term is open
+func currentTermID() (uint64, error) {
+	termCache := cache.GetGroupCache("term")
+	if termCache == nil {
+		termCache = cache.NewGroupCache("term", maxTermCacheBytes, cache.GetterFunc(CurrentTermGetter))
+	}
+	val, err := termCache.Get(currentTermKey, cache.DefaultOption)
+	if err != nil {
+		return 0, err
+	}
+	if val.Len() == 0 {
+		return 0, nil
+	}
+	return strconv.ParseUint(val.String(), 10, 64)
+}
+
+//return termID if it is set, otherwise the current term
+func resolveTermID(termID uint64) (uint64, int, constval.ErrNo) {
+	if termID != 0 {
+		return termID, http.StatusOK, constval.OK
+	}
+	current, err := currentTermID()
+	if err != nil {
+		logger.GetInstance().WithField("err", err).Errorln("get current term error")
+		return 0, http.StatusInternalServerError, constval.UnknownError
+	}
+	if current == 0 {
+		return 0, http.StatusBadRequest, constval.NoCurrentTerm
+	}
+	return current, http.StatusOK, constval.OK
+}
+
+//name of the term created for courses which existed before terms
+const legacyTermName = "legacy"
+
+//courses and enrollments created before terms existed have term_id 0. They are attached to the
+//open term. If no term is open, a term named legacy is used, and it is created open so that the
+//courses can still be booked as before
+func backfillTerm() error {
+	var courses, enrollments int64
+	if err := Db.Model(&Course{}).Where("term_id = 0").Count(&courses).Error; err != nil {
+		return err
+	}
+	if err := Db.Model(&StudentCourse{}).Where("term_id = 0").Count(&enrollments).Error; err != nil {
+		return err
+	}
+	if courses == 0 && enrollments == 0 {
+		return nil
+	}
+	return Db.Transaction(func(tx *gorm.DB) error {
+		term := &Term{}
+		result := tx.Where("status = ?", TermOpen).Limit(1).Find(term)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			now := time.Now()
+			err := tx.Where(Term{Name: legacyTermName}).
+				Attrs(Term{StartDate: now, EndDate: now.AddDate(0, 6, 0), Status: TermOpen, CreatedAt: now}).
+				FirstOrCreate(term).Error
+			if err != nil {
+				return err
+			}
+		}
+		logger.GetInstance().WithFields(logrus.Fields{
+			"term_id":     term.TermID,
+			"courses":     courses,
+			"enrollments": enrollments,
+		}).Infoln("attach courses created before terms to term")
+
+		if err := tx.Model(&Course{}).Where("term_id = 0").Update("term_id", term.TermID).Error; err != nil {
+			return err
+		}
+		//an enrollment takes the term of its course, enrollments of deleted courses take the term too
+		return tx.Exec("UPDATE student_course SET term_id = COALESCE("+
+			"(SELECT course.term_id FROM course WHERE course.course_id = student_course.course_id), ?) "+
+			"WHERE term_id = 0", term.TermID).Error
+	})
+}
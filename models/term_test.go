@@ -0,0 +1,34 @@
+package models
+
+import "testing"
+
+func TestBackfillTerm(t *testing.T) {
+	setupBookingDb(t)
+	course := newTestCourse(t, 10)
+	student := newTestStudents(t, 1)[0]
+	if err := Db.Model(course).Update("term_id", 0).Error; err != nil {
+		t.Fatalf("reset term of course error: %v", err)
+	}
+	err := Db.Exec("INSERT INTO student_course (student_id, course_id, term_id) VALUES (?, ?, 0)",
+		student, course.CourseID).Error
+	if err != nil {
+		t.Fatalf("insert enrollment error: %v", err)
+	}
+
+	if err = backfillTerm(); err != nil {
+		t.Fatalf("backfill term error: %v", err)
+	}
+	//the open term of the test database takes them
+	sc := &StudentCourse{}
+	err = Db.Where("course_id = ?", course.CourseID).First(course).Error
+	if err == nil {
+		err = Db.Where("course_id = ?", course.CourseID).First(sc).Error
+	}
+	if err != nil {
+		t.Fatalf("query backfilled rows error: %v", err)
+	}
+	if course.TermID != bookingTerm.TermID || sc.TermID != bookingTerm.TermID {
+		t.Errorf("want term %d, got course term %d and enrollment term %d",
+			bookingTerm.TermID, course.TermID, sc.TermID)
+	}
+}
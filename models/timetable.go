@@ -0,0 +1,160 @@
+package models
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/astaxie/beego/validation"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/timetable"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//a weekly meeting of a course in SetCourseSlotsForm
+type SlotForm struct {
+	timetable.Slot
+	Location string `json:"location"`
+}
+
+//used for setting weekly meeting slots of a course, admin only. Old slots are replaced
+type SetCourseSlotsForm struct {
+	CourseID uint64     `json:"course_id" valid:"Required"`
+	Slots    []SlotForm `json:"slots"`
+}
+
+//validate slots, called by beego validation after the tag rules
+func (s *SetCourseSlotsForm) Valid(v *validation.Validation) {
+	for i, slot := range s.Slots {
+		if !slot.Slot.Valid() {
+			v.SetError("slots", "slot "+strconv.Itoa(i)+" out of range")
+			return
+		}
+		v.MaxSize(slot.Location, 64, "location")
+		for _, other := range s.Slots[:i] {
+			if slot.Overlaps(other.Slot) {
+				v.SetError("slots", "slot "+strconv.Itoa(i)+" overlaps another slot")
+				return
+			}
+		}
+	}
+}
+
+func (s *SetCourseSlotsForm) SetCourseSlots(actor Actor) (int, constval.ErrNo) {
+	course := &Course{}
+	slots := make([]CourseSlot, len(s.Slots))
+	for i, slot := range s.Slots {
+		slots[i] = CourseSlot{CourseID: s.CourseID, Slot: slot.Slot, Location: slot.Location}
+	}
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("course_id").
+			Where("course_id = ?", s.CourseID).Limit(1).Find(course)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		before := []CourseSlot{}
+		if err := tx.Where("course_id = ?", s.CourseID).Find(&before).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("course_id = ?", s.CourseID).Delete(&CourseSlot{}).Error; err != nil {
+			return err
+		}
+		if len(slots) > 0 {
+			if err := tx.Create(&slots).Error; err != nil {
+				return err
+			}
+		}
+		return writeAudit(tx, actor, AuditSetSlots, AuditTargetCourse, strconv.FormatUint(s.CourseID, 10),
+			before, slots)
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"course_id": s.CourseID,
+			"err":       err,
+		}).Errorln("set course slots error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if course.CourseID == 0 {
+		return http.StatusBadRequest, constval.CourseNotExist
+	}
+	invalidateCourseCache(strconv.FormatUint(s.CourseID, 10))
+	return http.StatusOK, constval.OK
+}
+
+//used for getting the weekly timetable of a student in the current term
+type GetTimetableForm struct {
+	UserID string `form:"user_id" valid:"Required;Numeric"`
+	Week   int    `form:"week" valid:"Range(0,30)"` //0 means all weeks
+}
+
+func (g *GetTimetableForm) GetTimetable(days *[]timetable.Day) (int, constval.ErrNo) {
+	courses := []Course{}
+	httpCode, errCode := GetStudentCourseForm{UserID: g.UserID}.GetStudentCourse(&courses)
+	if errCode != constval.OK {
+		return httpCode, errCode
+	}
+	entries := []timetable.Entry{}
+	for _, course := range courses {
+		for _, slot := range course.Slots {
+			entries = append(entries, timetable.Entry{
+				Slot:       slot.Slot,
+				CourseID:   course.CourseID,
+				CourseName: course.CourseName,
+				Location:   slot.Location,
+			})
+		}
+	}
+	*days = timetable.Grid(entries, g.Week)
+	return http.StatusOK, constval.OK
+}
+
+//reject the course if it meets at the same time as a booked course of the student. Booked courses
+//are read from cache, so the check is repeated in the booking transaction by conflictingCourse
+func (b BookCourseForm) checkConflict(course *Course, result *BookResult) (int, constval.ErrNo) {
+	if len(course.Slots) == 0 {
+		return http.StatusOK, constval.OK
+	}
+	booked := []Course{}
+	httpCode, errCode := GetStudentCourseForm{UserID: b.UserID}.GetStudentCourse(&booked)
+	if errCode != constval.OK {
+		return httpCode, errCode
+	}
+	if conflict := firstConflict(booked, course); conflict != nil {
+		result.ConflictCourseID = conflict.CourseID
+		result.ConflictCourseName = conflict.CourseName
+		return http.StatusBadRequest, constval.CourseTimeConflict
+	}
+	return http.StatusOK, constval.OK
+}
+
+//the booked course of the student in the term of course which meets at the same time as course.
+//Called in tx after the student is locked, so that enrollments of concurrent bookings are seen
+func conflictingCourse(tx *gorm.DB, studentID string, course *Course) (*Course, error) {
+	if len(course.Slots) == 0 {
+		return nil, nil
+	}
+	booked := []Course{}
+	err := tx.Preload("Slots").Where("course_id IN (?) AND course_id <> ?",
+		tx.Model(&StudentCourse{}).Select("course_id").Where("student_id = ? AND term_id = ?", studentID, course.TermID),
+		course.CourseID).Find(&booked).Error
+	if err != nil {
+		return nil, err
+	}
+	return firstConflict(booked, course), nil
+}
+
+//the first of booked which meets at the same time as course, nil if none
+func firstConflict(booked []Course, course *Course) *Course {
+	for i := range booked {
+		for _, slot := range booked[i].Slots {
+			for _, target := range course.Slots {
+				if slot.Overlaps(target.Slot) {
+					return &booked[i]
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -3,11 +3,17 @@ package models
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/astaxie/beego/validation"
 	"github.com/hollowdjj/course-selecting-sys/cache"
 	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
 	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
@@ -22,13 +28,22 @@ type CreateUserForm struct {
 	UserType int    `json:"user_type" valid:"Required;Range(1,3)"`
 }
 
-func (c *CreateUserForm) CreateUser(user *User) (int, constval.ErrNo) {
-	result := Db.FirstOrCreate(user, *user)
-	if err := result.Error; err != nil {
+func (c *CreateUserForm) CreateUser(user *User, actor Actor) (int, constval.ErrNo) {
+	var created int64
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where(User{Username: user.Username}).FirstOrCreate(user)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		created = result.RowsAffected
+		return writeAudit(tx, actor, AuditCreateUser, AuditTargetUser, strconv.FormatUint(user.UserID, 10),
+			nil, user.Info())
+	})
+	if err != nil {
 		logger.GetInstance().WithField("err", err).Errorln("create user error")
 		return http.StatusInternalServerError, constval.UnknownError
 	}
-	if result.RowsAffected == 0 {
+	if created == 0 {
 		logger.GetInstance().WithField("username", c.Username).Infoln("username already exist")
 		return http.StatusBadRequest, constval.UserExisted
 	}
@@ -36,43 +51,242 @@ func (c *CreateUserForm) CreateUser(user *User) (int, constval.ErrNo) {
 	return http.StatusOK, constval.OK
 }
 
-//used for update user's nickname
+//used for updating a member. Nil fields are left unchanged. Admins can update any member,
+//others can only update nickname and contact info of themselves
 type UpdateMemberForm struct {
-	UserID   uint64 `json:"user_id" valid:"Required"` //uint加上required，表示只接受正整数
-	Nickname string `json:"nickname" valid:"Required;MinSize(4);MaxSize(20)"`
+	UserID     uint64  `json:"user_id" valid:"Required"` //uint加上required，表示只接受正整数
+	Nickname   *string `json:"nickname"`
+	Number     *string `json:"number"`
+	Department *string `json:"department"`
+	Grade      *int    `json:"grade"`
+	Email      *string `json:"email"` //empty string clears email
+	Phone      *string `json:"phone"` //empty string clears phone
 }
 
-func (u *UpdateMemberForm) UpdateUser() (int, constval.ErrNo) {
-	result := Db.Model(&User{}).Where("user_id = ?", u.UserID).Update("nickname", u.Nickname)
-	if result.Error != nil {
+//validate optional fields, called by beego validation after the tag rules
+func (u *UpdateMemberForm) Valid(v *validation.Validation) {
+	if u.Nickname == nil && u.Number == nil && u.Department == nil && u.Grade == nil && u.Email == nil && u.Phone == nil {
+		v.SetError("nickname", "nothing to update")
+		return
+	}
+	if u.Nickname != nil {
+		v.MinSize(*u.Nickname, 4, "nickname")
+		v.MaxSize(*u.Nickname, 20, "nickname")
+	}
+	if u.Number != nil {
+		v.MaxSize(*u.Number, 32, "number")
+	}
+	if u.Department != nil {
+		v.MaxSize(*u.Department, 64, "department")
+	}
+	if u.Grade != nil && *u.Grade != 0 {
+		v.Range(*u.Grade, 1900, 2100, "grade")
+	}
+	if u.Email != nil && *u.Email != "" {
+		v.Email(*u.Email, "email")
+		v.MaxSize(*u.Email, 128, "email")
+	}
+	if u.Phone != nil && *u.Phone != "" {
+		v.Phone(*u.Phone, "phone")
+	}
+}
+
+func (u *UpdateMemberForm) UpdateUser(operator *UserInfo, actor Actor) (int, constval.ErrNo) {
+	//number, department and grade decide enrollment rules, so only admins can change them
+	if operator.UserType != int(Admin) &&
+		(operator.UserID != u.UserID || u.Number != nil || u.Department != nil || u.Grade != nil) {
+		return http.StatusForbidden, constval.PermDenied
+	}
+
+	before := &User{}
+	var beforeInfo, afterInfo UserInfo
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", u.UserID).Limit(1).Find(before)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		beforeInfo, afterInfo = before.Info(), before.Info()
+		if err := LoadProfile(&beforeInfo); err != nil {
+			return err
+		}
+
+		if u.Nickname != nil {
+			err := tx.Model(&User{}).Where("user_id = ?", u.UserID).Update("nickname", *u.Nickname).Error
+			if err != nil {
+				return err
+			}
+			afterInfo.Nickname = *u.Nickname
+		}
+
+		profile := Profile{UserID: u.UserID}
+		if beforeInfo.Profile != nil {
+			profile = *beforeInfo.Profile
+		}
+		changed := false
+		for _, f := range []struct {
+			src *string
+			dst *string
+		}{{u.Number, &profile.Number}, {u.Department, &profile.Department}, {u.Email, &profile.Email}, {u.Phone, &profile.Phone}} {
+			if f.src != nil {
+				*f.dst, changed = *f.src, true
+			}
+		}
+		if u.Grade != nil {
+			profile.Grade, changed = *u.Grade, true
+		}
+		afterInfo.Profile = beforeInfo.Profile
+		if changed {
+			if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&profile).Error; err != nil {
+				return err
+			}
+			afterInfo.Profile = &profile
+		}
+		return writeAudit(tx, actor, AuditUpdateUser, AuditTargetUser, strconv.FormatUint(u.UserID, 10),
+			beforeInfo, afterInfo)
+	})
+	if err != nil {
 		logger.GetInstance().WithFields(logrus.Fields{
-			"user_id":  u.UserID,
-			"nickname": u.Nickname,
-		}).Errorln("update user nickname error")
+			"user_id": u.UserID,
+			"err":     err,
+		}).Errorln("update user error")
 		return http.StatusInternalServerError, constval.UnknownError
 	}
+	if before.UserID == 0 {
+		return http.StatusBadRequest, constval.UserNotExist
+	}
+	invalidateUserCache(strconv.FormatUint(u.UserID, 10))
 	return http.StatusOK, constval.OK
 }
 
 //used for del or get user
 type DelOrGetUserForm struct {
-	UserID string `form:"user_id" json:"user_id" valid:"Required"`
+	UserID          string `form:"user_id" json:"user_id" valid:"Required"`
+	IncludeInactive bool   `form:"include_inactive" json:"-"` //only for get, deleted user is returned too
 }
 
-func (d *DelOrGetUserForm) DeleteUser() (int, constval.ErrNo) {
-	result := Db.Model(&User{}).Where("user_id = ?", d.UserID).Update("is_active", 0)
-	if result.Error != nil {
-		logger.GetInstance().WithField("user_id", d.UserID).Errorln("del user error")
+//deactivate a user. The user is purged after the retention period unless restored
+func (d *DelOrGetUserForm) DeleteUser(actor Actor) (int, constval.ErrNo) {
+	var deleted int64
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("user_id = ? AND is_active = 1", d.UserID).
+			Updates(map[string]interface{}{"is_active": 0, "deactivated_at": time.Now()})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return writeAudit(tx, actor, AuditDeleteUser, AuditTargetUser, d.UserID,
+			map[string]interface{}{"is_active": 1}, map[string]interface{}{"is_active": 0})
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": d.UserID,
+			"err":     err,
+		}).Errorln("del user error")
 		return http.StatusInternalServerError, constval.UnknownError
 	}
-	if result.RowsAffected == 0 {
+	if deleted == 0 {
 		logger.GetInstance().WithField("user_id", d.UserID).Infoln("user deleted or not exist")
 		return http.StatusBadRequest, constval.UserDeletedOrNotExist
 	}
+
+	//force logout the deactivated user
+	userID, _ := strconv.ParseUint(d.UserID, 10, 64)
+	if _, err := RevokeUserSessions(userID); err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": d.UserID,
+			"err":     err,
+		}).Errorln("revoke sessions of deleted user error")
+	}
+	invalidateUserCache(d.UserID)
+	return http.StatusOK, constval.OK
+}
+
+//used for restoring a deleted user, admin only
+type RestoreUserForm struct {
+	UserID uint64 `json:"user_id" valid:"Required"`
+}
+
+func (r *RestoreUserForm) RestoreUser(actor Actor) (int, constval.ErrNo) {
+	var restored int64
+	userID := strconv.FormatUint(r.UserID, 10)
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("user_id = ? AND is_active = 0", r.UserID).
+			Updates(map[string]interface{}{"is_active": 1, "deactivated_at": nil})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		restored = result.RowsAffected
+		return writeAudit(tx, actor, AuditRestoreUser, AuditTargetUser, userID,
+			map[string]interface{}{"is_active": 0}, map[string]interface{}{"is_active": 1})
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": r.UserID,
+			"err":     err,
+		}).Errorln("restore user error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if restored == 0 {
+		logger.GetInstance().WithField("user_id", r.UserID).Infoln("user active or not exist")
+		return http.StatusBadRequest, constval.UserActiveOrNotExist
+	}
+	invalidateUserCache(userID)
 	return http.StatusOK, constval.OK
 }
 
+//drop cached user info so that the latest user state is loaded on next query
+func invalidateUserCache(userID string) {
+	user := &User{}
+	Db.Select("username").Where("user_id = ?", userID).Limit(1).Find(user)
+	if groupCacheLogin := cache.GetGroupCache("login"); groupCacheLogin != nil && user.Username != "" {
+		groupCacheLogin.Del(user.Username)
+	}
+	if groupCacheUser := cache.GetGroupCache("user"); groupCacheUser != nil {
+		groupCacheUser.Del(userID)
+	}
+}
+
+//get a member for viewer. Only admins may include inactive users, and the profile holding the
+//contact fields is only returned to the member themselves or to an admin
+func (d *DelOrGetUserForm) GetMember(viewer *UserInfo, userInfo *UserInfo) (int, constval.ErrNo) {
+	isAdmin := viewer.UserType == int(Admin)
+	if d.IncludeInactive && !isAdmin {
+		return http.StatusForbidden, constval.PermDenied
+	}
+	if httpCode, errCode := d.GetUserInfo(userInfo); errCode != constval.OK {
+		return httpCode, errCode
+	}
+	if !isAdmin && viewer.UserID != userInfo.UserID {
+		userInfo.Profile = nil
+	}
+	return http.StatusOK, constval.OK
+}
+
+//get an active user, or any user if IncludeInactive is set
 func (d *DelOrGetUserForm) GetUserInfo(userInfo *UserInfo) (int, constval.ErrNo) {
+	//the cache only holds active users
+	if d.IncludeInactive {
+		result := Db.Model(&User{}).Where("user_id = ?", d.UserID).Limit(1).Find(userInfo)
+		if result.Error != nil {
+			logger.GetInstance().WithFields(logrus.Fields{
+				"user_id": d.UserID,
+				"err":     result.Error,
+			}).Errorln("query user info error")
+			return http.StatusInternalServerError, constval.UnknownError
+		}
+		if result.RowsAffected == 0 {
+			return http.StatusBadRequest, constval.UserNotExist
+		}
+		if err := LoadProfile(userInfo); err != nil {
+			logger.GetInstance().WithFields(logrus.Fields{
+				"user_id": d.UserID,
+				"err":     err,
+			}).Errorln("query user profile error")
+			return http.StatusInternalServerError, constval.UnknownError
+		}
+		return http.StatusOK, constval.OK
+	}
+
 	groupCacheUser := cache.GetGroupCache("user")
 	if groupCacheUser == nil {
 		groupCacheUser = cache.NewGroupCache("user", maxUserInfoCacheBytes, cache.GetterFunc(UserInfoGetterByUserID))
@@ -85,6 +299,9 @@ func (d *DelOrGetUserForm) GetUserInfo(userInfo *UserInfo) (int, constval.ErrNo)
 		}).Errorln("get user info error")
 		return http.StatusInternalServerError, constval.UnknownError
 	}
+	if val.Len() == 0 {
+		return http.StatusBadRequest, constval.UserDeletedOrNotExist
+	}
 	//unmarshal user info
 	err = json.Unmarshal(val.ByteSlice(), userInfo)
 	if err != nil {
@@ -95,21 +312,86 @@ func (d *DelOrGetUserForm) GetUserInfo(userInfo *UserInfo) (int, constval.ErrNo)
 	return http.StatusOK, constval.OK
 }
 
-//used from get user list
+//used from get user list. Cursor is preferred, offset is kept for old clients
 type GetUserListForm struct {
-	Offset int `form:"offset" valid:"Min(0)"`
-	Limit  int `form:"limit" valid:"Min(-1)"`
+	Offset   int    `form:"offset" valid:"Min(0)"`
+	Limit    int    `form:"limit" valid:"Min(0)"` //0 means MaxPageSize, larger ones are clamped to it
+	Cursor   string `form:"cursor" valid:"MaxSize(512)"`
+	UserType int    `form:"user_type" valid:"Range(0,3)"`       //0 means all user types
+	IsActive string `form:"is_active" valid:"Match(/^[01]?$/)"` //empty means active only
+	//list deleted users too when is_active is empty
+	IncludeInactive bool   `form:"include_inactive"`
+	Username        string `form:"username" valid:"MaxSize(20)"` //username prefix
+	Nickname        string `form:"nickname" valid:"MaxSize(20)"` //nickname prefix
+	SortBy          string `form:"sort_by" valid:"Match(/^(|user_id|username|nickname|user_type)$/)"`
+	Order           string `form:"order" valid:"Match(/^(|asc|desc)$/)"`
+}
+
+//build the filtered query of user list
+func (g *GetUserListForm) query() *gorm.DB {
+	query := Db.Model(&User{})
+	if g.UserType != 0 {
+		query = query.Where("user_type = ?", g.UserType)
+	}
+	if g.IsActive != "" {
+		query = query.Where("is_active = ?", g.IsActive)
+	} else if !g.IncludeInactive {
+		query = query.Where("is_active = 1")
+	}
+	if g.Username != "" {
+		query = query.Where("username LIKE ?", utility.EscapeLike(g.Username)+"%")
+	}
+	if g.Nickname != "" {
+		query = query.Where("nickname LIKE ?", utility.EscapeLike(g.Nickname)+"%")
+	}
+	return query
 }
 
-func (g *GetUserListForm) GetUserList(userList *[]UserInfo) (int, constval.ErrNo) {
-	err := Db.Model(&User{}).Offset(g.Offset).Limit(g.Limit).Find(userList).Error
+//list users for viewer. Only admins may list deleted users
+func (g *GetUserListForm) GetUserList(viewer *UserInfo, userList *[]UserInfo, total *int64, page *Page) (int, constval.ErrNo) {
+	if (g.IncludeInactive || g.IsActive == "0") && viewer.UserType != int(Admin) {
+		return http.StatusForbidden, constval.PermDenied
+	}
+	k := keyset{pk: "user_id", sort: "user_id", desc: g.Order == "desc", limit: pageSize(g.Limit)}
+	if g.SortBy != "" {
+		k.sort = g.SortBy
+	}
+	cursor, err := decodeCursor(g.Cursor, k.pk, k.sort)
+	if err != nil {
+		return http.StatusBadRequest, constval.ParamInvalid
+	}
+	k.cursor = cursor
+
+	err = g.query().Count(total).Error
+	if err == nil {
+		if g.Offset > 0 {
+			err = k.apply(g.query()).Offset(g.Offset).Limit(k.limit).Find(userList).Error
+		} else {
+			err = k.apply(g.query()).Find(userList).Error
+		}
+	}
 	if err != nil {
 		logger.GetInstance().WithFields(logrus.Fields{
-			"offset": g.Offset,
-			"limit":  g.Limit,
-			"err":    err,
+			"form": *g,
+			"err":  err,
 		}).Errorln("get user list error")
 		return http.StatusInternalServerError, constval.UnknownError
 	}
+	if g.Offset > 0 {
+		return http.StatusOK, constval.OK
+	}
+
+	*page = k.page(userList, func(i int) (uint64, string) {
+		u := (*userList)[i]
+		switch k.sort {
+		case "username":
+			return u.UserID, u.Username
+		case "nickname":
+			return u.UserID, u.Nickname
+		case "user_type":
+			return u.UserID, strconv.Itoa(u.UserType)
+		}
+		return u.UserID, ""
+	})
 	return http.StatusOK, constval.OK
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+)
+
+func TestGetMemberIncludeInactive(t *testing.T) {
+	form := &DelOrGetUserForm{UserID: "2", IncludeInactive: true}
+	viewer := &UserInfo{UserID: 2, UserType: int(Student)}
+	if _, errCode := form.GetMember(viewer, &UserInfo{}); errCode != constval.PermDenied {
+		t.Errorf("want deleted members hidden from non-admins, got %s", constval.GetErrCodeMsg(errCode))
+	}
+}
+
+func TestGetUserListInactive(t *testing.T) {
+	viewer := &UserInfo{UserID: 2, UserType: int(Student)}
+	for _, form := range []GetUserListForm{{IncludeInactive: true}, {IsActive: "0"}} {
+		_, errCode := form.GetUserList(viewer, &[]UserInfo{}, new(int64), &Page{})
+		if errCode != constval.PermDenied {
+			t.Errorf("%+v: want deleted users hidden from non-admins, got %s", form, constval.GetErrCodeMsg(errCode))
+		}
+	}
+}
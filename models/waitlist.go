@@ -0,0 +1,429 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/conf"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/notify"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//status of a waitlist entry
+const (
+	WaitWaiting  = "waiting"
+	WaitPromoted = "promoted" //a seat is held for the student until ClaimUntil
+	WaitClaimed  = "claimed"
+	WaitExpired  = "expired"
+	WaitLeft     = "left"
+	WaitRejected = "rejected" //the claim was refused and the seat given to the next one
+)
+
+//used for joining, leaving or claiming a waitlist
+type WaitlistForm struct {
+	UserID   string `valid:"Required;Numeric"`
+	CourseID string `valid:"Required;Numeric"`
+}
+
+//join the waitlist of a full course. The same checks as booking are done first so that
+//a promoted student can claim the seat
+func (w WaitlistForm) JoinWaitlist(actor Actor, entry *Waitlist, bookResult *BookResult) (int, constval.ErrNo) {
+	course := &Course{}
+	if httpCode, errCode := (GetCourseForm{CourseID: w.CourseID}).GetCourseInfo(course); errCode != constval.OK {
+		return httpCode, errCode
+	}
+	phase := EnrollmentPhase{}
+	b := BookCourseForm{UserID: w.UserID, CourseID: w.CourseID}
+	if httpCode, errCode := b.precheck(course, &phase, bookResult); errCode != constval.OK {
+		return httpCode, errCode
+	}
+
+	studentID, _ := strconv.ParseUint(w.UserID, 10, 64)
+	errCode := constval.OK
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		//lock the course so that a seat can not be freed while joining
+		locked := &Course{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("course_id", "remain_cap").
+			Where("course_id = ?", course.CourseID).Find(locked).Error
+		if err != nil {
+			return err
+		}
+		if locked.RemainCap > 0 {
+			errCode = constval.CourseHasSeats
+			return nil
+		}
+		var count int64
+		err = tx.Model(&StudentCourse{}).Where("student_id = ? AND course_id = ?", w.UserID, w.CourseID).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			errCode = constval.StudentHasCourse
+			return nil
+		}
+		err = tx.Model(&Waitlist{}).Where("student_id = ? AND course_id = ? AND status IN ?",
+			w.UserID, w.CourseID, []string{WaitWaiting, WaitPromoted}).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			errCode = constval.WaitlistExisted
+			return nil
+		}
+
+		*entry = Waitlist{CourseID: course.CourseID, StudentID: studentID, Status: WaitWaiting}
+		if err = tx.Create(entry).Error; err != nil {
+			return err
+		}
+		if entry.Position, err = waitPosition(tx, entry); err != nil {
+			return err
+		}
+		return writeAudit(tx, actor, AuditJoinWaitlist, AuditTargetCourse, w.CourseID,
+			nil, map[string]interface{}{"student_id": w.UserID, "wait_id": entry.WaitID})
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"form": w,
+			"err":  err,
+		}).Errorln("join waitlist error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if errCode != constval.OK {
+		return http.StatusBadRequest, errCode
+	}
+	return http.StatusOK, constval.OK
+}
+
+//leave the waitlist. A seat held for the student is given to the next one
+func (w WaitlistForm) LeaveWaitlist(actor Actor) (int, constval.ErrNo) {
+	entry := &Waitlist{}
+	var promoted *Waitlist
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("student_id = ? AND course_id = ? AND status IN ?", w.UserID, w.CourseID,
+				[]string{WaitWaiting, WaitPromoted}).Limit(1).Find(entry)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		before := *entry
+		err := tx.Model(entry).Update("status", WaitLeft).Error
+		if err != nil {
+			return err
+		}
+		if before.Status == WaitPromoted {
+			if promoted, err = releaseSeat(tx, entry.CourseID); err != nil {
+				return err
+			}
+		}
+		return writeAudit(tx, actor, AuditLeaveWaitlist, AuditTargetCourse, w.CourseID, before, entry)
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"form": w,
+			"err":  err,
+		}).Errorln("leave waitlist error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if entry.WaitID == 0 {
+		return http.StatusBadRequest, constval.WaitlistNotExist
+	}
+	invalidateEnrollmentCache(w.UserID, w.CourseID)
+	notifyPromoted(promoted)
+	return http.StatusOK, constval.OK
+}
+
+//claim the seat held for a promoted student before the claim window closes. If the student
+//cannot take the seat, the promotion ends and the seat is given to the next one
+func (w WaitlistForm) ClaimWaitlist(actor Actor, bookResult *BookResult) (int, constval.ErrNo) {
+	course := &Course{}
+	if httpCode, errCode := (GetCourseForm{CourseID: w.CourseID}).GetCourseInfo(course); errCode != constval.OK {
+		return httpCode, errCode
+	}
+	limit := CreditLimit{}
+	if err := creditLimitOf(Db, w.UserID, course.TermID, &limit); err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid": w.UserID,
+			"err":    err,
+		}).Errorln("get credit limit error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+
+	entry := &Waitlist{}
+	rejected := constval.OK
+	var promoted *Waitlist
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("student_id = ? AND course_id = ? AND status = ? AND claim_until > ?",
+				w.UserID, w.CourseID, WaitPromoted, time.Now()).Limit(1).Find(entry)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		if err := lockStudent(tx, w.UserID); err != nil {
+			return err
+		}
+		var err error
+		if rejected, err = w.checkClaim(tx, course, &limit, bookResult); err != nil {
+			return err
+		}
+		before := *entry
+		if rejected != constval.OK {
+			//the seat is not kept for a student who cannot take it
+			if err = tx.Model(entry).Update("status", WaitRejected).Error; err != nil {
+				return err
+			}
+			if promoted, err = releaseSeat(tx, entry.CourseID); err != nil {
+				return err
+			}
+			return writeAudit(tx, actor, AuditClaimWaitlist, AuditTargetCourse, w.CourseID, before, entry)
+		}
+
+		//the seat is already held, so remain_cap is not changed
+		err = tx.Create(&StudentCourse{StudentID: entry.StudentID, CourseID: entry.CourseID, TermID: course.TermID}).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Model(entry).Update("status", WaitClaimed).Error; err != nil {
+			return err
+		}
+		return writeAudit(tx, actor, AuditClaimWaitlist, AuditTargetCourse, w.CourseID,
+			nil, map[string]interface{}{"student_id": w.UserID, "wait_id": entry.WaitID})
+	})
+	if isDuplicateKey(err) {
+		return http.StatusBadRequest, constval.StudentHasCourse
+	}
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"form": w,
+			"err":  err,
+		}).Errorln("claim waitlist error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	if entry.WaitID == 0 {
+		return http.StatusBadRequest, constval.WaitlistNotExist
+	}
+	invalidateEnrollmentCache(w.UserID, w.CourseID)
+	if rejected != constval.OK {
+		notifyPromoted(promoted)
+		if rejected == constval.CreditLimitExceeded {
+			bookResult.MaxCredits = limit.MaxCredits
+		}
+		return http.StatusBadRequest, rejected
+	}
+	return http.StatusOK, constval.OK
+}
+
+//checks before the student takes the held seat, which may fail since the student joined the
+//waitlist. Return the reason if the student cannot take it
+func (w WaitlistForm) checkClaim(tx *gorm.DB, course *Course, limit *CreditLimit, bookResult *BookResult) (constval.ErrNo, error) {
+	//another section may be booked while waiting
+	other, err := hasOtherSection(tx, w.UserID, course)
+	if err != nil {
+		return constval.OK, err
+	}
+	if other {
+		return constval.SectionConflict, nil
+	}
+	//the timetable may have changed since joining
+	conflict, err := conflictingCourse(tx, w.UserID, course)
+	if err != nil {
+		return constval.OK, err
+	}
+	if conflict != nil {
+		bookResult.ConflictCourseID = conflict.CourseID
+		bookResult.ConflictCourseName = conflict.CourseName
+		return constval.CourseTimeConflict, nil
+	}
+	if limit.MaxCredits > 0 {
+		exceeded, err := exceedsCredits(tx, w.UserID, course.TermID, course.Credits, limit.MaxCredits)
+		if err != nil {
+			return constval.OK, err
+		}
+		if exceeded {
+			return constval.CreditLimitExceeded, nil
+		}
+	}
+	return constval.OK, nil
+}
+
+//used for quering the waitlist entries of a student
+type GetWaitlistForm struct {
+	UserID string `form:"user_id" valid:"Required;Numeric"`
+}
+
+func (g GetWaitlistForm) GetWaitlist(entries *[]Waitlist) (int, constval.ErrNo) {
+	err := Db.Where("student_id = ? AND status IN ?", g.UserID, []string{WaitWaiting, WaitPromoted}).
+		Order("wait_id").Find(entries).Error
+	if err == nil {
+		for i := range *entries {
+			if (*entries)[i].Position, err = waitPosition(Db, &(*entries)[i]); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": g.UserID,
+			"err":     err,
+		}).Errorln("get waitlist error")
+		return http.StatusInternalServerError, constval.UnknownError
+	}
+	return http.StatusOK, constval.OK
+}
+
+//1-based position of a waiting entry in its course's waitlist, 0 for other status
+func waitPosition(tx *gorm.DB, entry *Waitlist) (int64, error) {
+	if entry.Status != WaitWaiting {
+		return 0, nil
+	}
+	var position int64
+	err := tx.Model(&Waitlist{}).Where("course_id = ? AND status = ? AND wait_id <= ?",
+		entry.CourseID, WaitWaiting, entry.WaitID).Count(&position).Error
+	return position, err
+}
+
+//give a freed seat of the course to the head of its waitlist, or back to remain_cap if
+//nobody is waiting. Return the promoted entry if any
+func releaseSeat(tx *gorm.DB, courseID uint64) (*Waitlist, error) {
+	head := &Waitlist{}
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("course_id = ? AND status = ?", courseID, WaitWaiting).Order("wait_id").Limit(1).Find(head)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		err := tx.Model(&Course{}).Where("course_id = ? AND remain_cap < cap", courseID).
+			Update("remain_cap", gorm.Expr("remain_cap + ?", 1)).Error
+		return nil, err
+	}
+
+	now := time.Now()
+	claimUntil := now.Add(claimWindow())
+	err := tx.Model(head).Updates(map[string]interface{}{
+		"status":      WaitPromoted,
+		"promoted_at": now,
+		"claim_until": claimUntil,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	head.Status, head.PromotedAt, head.ClaimUntil = WaitPromoted, &now, &claimUntil
+	return head, nil
+}
+
+func claimWindow() time.Duration {
+	window := time.Duration(conf.GetWaitlist().ClaimWindow) * time.Minute
+	if window <= 0 {
+		window = 30 * time.Minute
+	}
+	return window
+}
+
+//tell a promoted student to claim the held seat. Called after the transaction commits
+func notifyPromoted(entry *Waitlist) {
+	if entry == nil {
+		return
+	}
+	user := &User{}
+	err := Db.Select("user_id", "username").Where("user_id = ?", entry.StudentID).Find(user).Error
+	if err == nil && user.UserID != 0 {
+		err = notify.GetSender().Send(notify.Message{
+			To:      user.Username,
+			Subject: "waitlist promoted",
+			Content: fmt.Sprintf("a seat of course %d is held for you until %s", entry.CourseID,
+				entry.ClaimUntil.Format("2006-01-02 15:04:05")),
+		})
+	}
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"wait_id": entry.WaitID,
+			"err":     err,
+		}).Errorln("notify waitlist promotion error")
+	}
+}
+
+//start the background job which expires unclaimed promotions. All servers share one
+//database, so the job only runs on the main host
+func StartWaitlistJob() {
+	if conf.GetApp().Host != conf.GetApp().MainHost {
+		return
+	}
+	interval := time.Duration(conf.GetWaitlist().ExpireInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			expired, err := ExpireWaitlist(time.Now())
+			if err != nil {
+				logger.GetInstance().WithField("err", err).Errorln("expire waitlist error")
+			} else if expired > 0 {
+				logger.GetInstance().WithField("expired", expired).Infoln("expire waitlist succ")
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+//expire promotions not claimed before now and pass their seats on. Return the number of
+//expired entries
+func ExpireWaitlist(now time.Time) (int, error) {
+	waitIDs := []uint64{}
+	err := Db.Model(&Waitlist{}).Where("status = ? AND claim_until <= ?", WaitPromoted, now).
+		Order("wait_id").Pluck("wait_id", &waitIDs).Error
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, waitID := range waitIDs {
+		ok, err := expireEntry(waitID, now)
+		if err != nil {
+			return expired, err
+		}
+		if ok {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+//expire a promotion in one transaction. Return false if it was claimed or left meanwhile
+func expireEntry(waitID uint64, now time.Time) (bool, error) {
+	entry := &Waitlist{}
+	var promoted *Waitlist
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("wait_id = ? AND status = ? AND claim_until <= ?", waitID, WaitPromoted, now).Limit(1).Find(entry)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		err := tx.Model(entry).Update("status", WaitExpired).Error
+		if err != nil {
+			return err
+		}
+		promoted, err = releaseSeat(tx, entry.CourseID)
+		return err
+	})
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"wait_id": waitID,
+			"err":     err,
+		}).Errorln("expire waitlist entry error")
+		return false, err
+	}
+	if entry.WaitID == 0 {
+		return false, nil
+	}
+	invalidateEnrollmentCache(strconv.FormatUint(entry.StudentID, 10), strconv.FormatUint(entry.CourseID, 10))
+	notifyPromoted(promoted)
+	return true, nil
+}
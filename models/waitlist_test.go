@@ -0,0 +1,53 @@
+package models
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+)
+
+func TestClaimWaitlistRejected(t *testing.T) {
+	setupBookingDb(t)
+	course := newTestCourse(t, 1)
+	if err := Db.Model(course).Updates(map[string]interface{}{"remain_cap": 0, "credits": 3}).Error; err != nil {
+		t.Fatalf("update course error: %v", err)
+	}
+	students := newTestStudents(t, 2)
+	claimer, _ := strconv.ParseUint(students[0], 10, 64)
+	next, _ := strconv.ParseUint(students[1], 10, 64)
+	if err := Db.Create(&CreditLimit{StudentID: claimer, TermID: bookingTerm.TermID, MaxCredits: 2}).Error; err != nil {
+		t.Fatalf("create credit limit error: %v", err)
+	}
+	now := time.Now()
+	claimUntil := now.Add(time.Hour)
+	promoted := &Waitlist{CourseID: course.CourseID, StudentID: claimer, Status: WaitPromoted, PromotedAt: &now,
+		ClaimUntil: &claimUntil}
+	waiting := &Waitlist{CourseID: course.CourseID, StudentID: next, Status: WaitWaiting}
+	if err := Db.Create(promoted).Error; err != nil {
+		t.Fatalf("create waitlist entry error: %v", err)
+	}
+	if err := Db.Create(waiting).Error; err != nil {
+		t.Fatalf("create waitlist entry error: %v", err)
+	}
+
+	form := WaitlistForm{UserID: students[0], CourseID: strconv.FormatUint(course.CourseID, 10)}
+	if _, errCode := form.ClaimWaitlist(Actor{}, &BookResult{}); errCode != constval.CreditLimitExceeded {
+		t.Fatalf("want credit limit exceeded, got %d: %s", errCode, constval.GetErrCodeMsg(errCode))
+	}
+
+	//the held seat goes to the next student at once
+	if err := Db.First(promoted, promoted.WaitID).Error; err != nil {
+		t.Fatalf("query waitlist entry error: %v", err)
+	}
+	if err := Db.First(waiting, waiting.WaitID).Error; err != nil {
+		t.Fatalf("query waitlist entry error: %v", err)
+	}
+	if promoted.Status != WaitRejected || waiting.Status != WaitPromoted || waiting.ClaimUntil == nil {
+		t.Errorf("want the claim rejected and the next one promoted, got %s and %s", promoted.Status, waiting.Status)
+	}
+	if enrolled, remainCap := enrollmentOf(t, course); enrolled != 0 || remainCap != 0 {
+		t.Errorf("want the seat still held, got %d enrolled and remain_cap %d", enrolled, remainCap)
+	}
+}
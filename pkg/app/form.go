@@ -54,29 +54,37 @@ func BindAndValidCustom(c *gin.Context, form interface{}, funcs CustomFunc, json
 		return http.StatusBadRequest, constval.ParamInvalid
 	}
 
-	//setup custom validate function
-	valid := validation.Validation{}
-	for k, v := range funcs {
-		if err = validation.AddCustomFunc(k, v); err != nil {
-			logger.GetInstance().WithField("err", err).Errorln("set custom validate func error")
-			return http.StatusInternalServerError, constval.UnknownError
-		}
-	}
-
 	//validate form
-	check, err := valid.Valid(form)
+	errs, err := ValidCustom(form, funcs)
 	if err != nil {
 		logger.GetInstance().WithField("err", err).Errorln("validate request form error")
 		return http.StatusInternalServerError, constval.UnknownError
 	}
-	if !check {
-		MakeErrors(valid.Errors)
+	if len(errs) > 0 {
+		MakeErrors(errs)
 		return http.StatusBadRequest, constval.ParamInvalid
 	}
 
 	return http.StatusOK, constval.OK
 }
 
+//validate a form which is not bound from request, such as a row of uploaded file
+func ValidCustom(form interface{}, funcs CustomFunc) ([]*validation.Error, error) {
+	//setup custom validate function
+	valid := validation.Validation{}
+	for k, v := range funcs {
+		if err := validation.AddCustomFunc(k, v); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err := valid.Valid(form)
+	if err != nil {
+		return nil, err
+	}
+	return valid.Errors, nil
+}
+
 //print form validate error message
 func MakeErrors(errors []*validation.Error) {
 	fields := make(map[string]interface{})
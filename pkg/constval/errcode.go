@@ -31,6 +31,49 @@ const (
 
 	ParamInvalid
 	UnknownError
+
+	//codes are sent to clients, so new ones are only appended below and never inserted above
+
+	//for login
+	SessionNotExist
+	ResetTokenInvalid
+	ApiKeyNotExist
+
+	UserActiveOrNotExist
+	ImportFileInvalid
+	ImportTooManyRows
+
+	//for term
+	TermExisted
+	TermNotExist
+	TermStatusInvalid
+	TermOpenExisted
+	NoCurrentTerm
+	CourseNotInCurrentTerm
+
+	//for course
+	CatalogNotExist
+	SectionExisted
+	CourseHasStudents
+	CapBelowEnrolled
+
+	//for course selecting
+	EnrollmentClosed
+	CourseTimeConflict
+	SectionConflict
+	RequirementNotMet
+	CreditLimitExceeded
+	CourseNotBooked
+	DropDeadlinePassed
+	CourseHasSeats
+	WaitlistExisted
+	WaitlistNotExist
+	PhaseNotExist
+	BookingBusy
+	TicketNotExist
+
+	//for login
+	NotDirectoryUser
 )
 
 var msg = map[ErrNo]string{
@@ -43,7 +86,22 @@ var msg = map[ErrNo]string{
 	LoginRequired: "用户未登录",
 	PermDenied:    "没有操作权限",
 
+	SessionNotExist:   "会话不存在或已失效",
+	ResetTokenInvalid: "重置令牌无效或已过期",
+	ApiKeyNotExist:    "API Key不存在或已吊销",
+	NotDirectoryUser:  "本地账号不能通过目录登录",
+
 	UserDeletedOrNotExist: "用户不存在或已删除",
+	UserActiveOrNotExist:  "用户不存在或未删除",
+	ImportFileInvalid:     "导入文件格式错误",
+	ImportTooManyRows:     "导入文件行数过多",
+
+	TermExisted:            "学期已存在",
+	TermNotExist:           "学期不存在",
+	TermStatusInvalid:      "学期状态不允许该操作",
+	TermOpenExisted:        "已有开放中的学期",
+	NoCurrentTerm:          "当前没有开放的学期",
+	CourseNotInCurrentTerm: "课程不属于当前学期",
 
 	CourseExisted:      "课程已存在",
 	CourseNotExist:     "课程不存在",
@@ -52,10 +110,27 @@ var msg = map[ErrNo]string{
 	CourseNotBind:      "课程未绑定过",
 	UnBindError:        "课程绑定的不是该老师",
 	TeacherHasNoCourse: "老师没有该课程",
+	CatalogNotExist:    "目录课程不存在",
+	SectionExisted:     "该学期已存在同编号的教学班",
+	CourseHasStudents:  "课程已有学生选课",
+	CapBelowEnrolled:   "课程容量不能小于已选人数",
 
-	StudentNotExist:    "学生不存在",
-	StudentHasNoCourse: "学生没有选择任何课程",
-	StudentHasCourse:   "学生有课程",
+	StudentNotExist:     "学生不存在",
+	StudentHasNoCourse:  "学生没有选择任何课程",
+	StudentHasCourse:    "学生有课程",
+	EnrollmentClosed:    "当前不在选课时间段内",
+	CourseTimeConflict:  "与已选课程上课时间冲突",
+	SectionConflict:     "已选该课程的其他教学班",
+	RequirementNotMet:   "不满足课程的选课条件",
+	CreditLimitExceeded: "超出本学期学分上限",
+	CourseNotBooked:     "学生未选该课程",
+	DropDeadlinePassed:  "已过退课截止时间",
+	CourseHasSeats:      "课程仍有余量，请直接选课",
+	WaitlistExisted:     "已在该课程的候补队列中",
+	WaitlistNotExist:    "不在候补队列中或递补已失效",
+	PhaseNotExist:       "选课阶段不存在",
+	BookingBusy:         "选课人数过多，请稍后重试",
+	TicketNotExist:      "选课结果不存在或已过期",
 
 	ParamInvalid: "参数不合法",
 	UnknownError: "未知错误",
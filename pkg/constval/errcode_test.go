@@ -0,0 +1,39 @@
+package constval
+
+import "testing"
+
+//codes are part of the api, clients compare them with these numbers
+func TestErrCodeValues(t *testing.T) {
+	codes := map[ErrNo]int{
+		OK:                    0,
+		UserExisted:           1,
+		UserDeleted:           2,
+		UserNotExist:          3,
+		WrongPassword:         4,
+		LoginRequired:         5,
+		PermDenied:            6,
+		UserDeletedOrNotExist: 7,
+		CourseExisted:         8,
+		CourseNotExist:        9,
+		CourseNotAvailable:    10,
+		CourseHasBound:        11,
+		CourseNotBind:         12,
+		UnBindError:           13,
+		TeacherHasNoCourse:    14,
+		StudentNotExist:       15,
+		StudentHasNoCourse:    16,
+		StudentHasCourse:      17,
+		ParamInvalid:          18,
+		UnknownError:          19,
+	}
+	for code, want := range codes {
+		if int(code) != want {
+			t.Errorf("%s: want code %d, got %d", GetErrCodeMsg(code), want, code)
+		}
+	}
+	for code := OK; code <= NotDirectoryUser; code++ {
+		if GetErrCodeMsg(code) == "" {
+			t.Errorf("code %d has no message", code)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package event
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+//an event published to a topic, such as the result of a booking of a student
+type Event struct {
+	Topic string      `json:"topic"`
+	Name  string      `json:"name"`
+	Data  interface{} `json:"data"`
+}
+
+//Hub delivers events to subscribers of their topics in this process
+type Hub struct {
+	mu     sync.RWMutex
+	topics map[string]map[*Subscriber]struct{}
+	relay  func(Event) //guarded by mu
+}
+
+//Subscriber receives events of its topics from C until it is unsubscribed
+type Subscriber struct {
+	C      chan Event
+	topics map[string]struct{} //guarded by mu of the hub
+}
+
+func NewHub() *Hub {
+	return &Hub{topics: map[string]map[*Subscriber]struct{}{}}
+}
+
+//the hub used by the server
+var defaultHub = NewHub()
+
+func GetHub() *Hub {
+	return defaultHub
+}
+
+//subscribe topics. buffer is the number of events kept for a slow subscriber, more are dropped
+func (h *Hub) Subscribe(buffer int, topics ...string) *Subscriber {
+	s := &Subscriber{C: make(chan Event, buffer), topics: map[string]struct{}{}}
+	h.Add(s, topics...)
+	return s
+}
+
+//subscribe more topics for s
+func (h *Hub) Add(s *Subscriber, topics ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, topic := range topics {
+		if h.topics[topic] == nil {
+			h.topics[topic] = map[*Subscriber]struct{}{}
+		}
+		h.topics[topic][s] = struct{}{}
+		s.topics[topic] = struct{}{}
+	}
+}
+
+//stop delivering events of the topics to s
+func (h *Hub) Remove(s *Subscriber, topics ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, topic := range topics {
+		delete(h.topics[topic], s)
+		if len(h.topics[topic]) == 0 {
+			delete(h.topics, topic)
+		}
+		delete(s.topics, topic)
+	}
+}
+
+//stop delivering events to s. C is not closed, since a publisher may be sending to it
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.RLock()
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	h.mu.RUnlock()
+	h.Remove(s, topics...)
+}
+
+//number of topics s subscribes
+func (h *Hub) Count(s *Subscriber) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(s.topics)
+}
+
+//subscribed topics with the prefix, in order
+func (h *Hub) Topics(prefix string) []string {
+	h.mu.RLock()
+	topics := []string{}
+	for topic := range h.topics {
+		if strings.HasPrefix(topic, prefix) {
+			topics = append(topics, topic)
+		}
+	}
+	h.mu.RUnlock()
+	sort.Strings(topics)
+	return topics
+}
+
+//send an event to subscribers of the topic without blocking. Return the number of subscribers
+//which received it
+func (h *Hub) Publish(topic, name string, data interface{}) int {
+	e := Event{Topic: topic, Name: name, Data: data}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	sent := 0
+	for s := range h.topics[topic] {
+		select {
+		case s.C <- e:
+			sent++
+		default:
+		}
+	}
+	return sent
+}
+
+//whether anyone subscribes the topic
+func (h *Hub) HasSubscribers(topic string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics[topic]) > 0
+}
+
+//set the function which sends broadcast events to other nodes, nil stops relaying
+func (h *Hub) SetRelay(relay func(Event)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.relay = relay
+}
+
+//publish an event to subscribers of this node and relay it to other nodes. Return the number of
+//subscribers of this node which received it
+func (h *Hub) Broadcast(topic, name string, data interface{}) int {
+	sent := h.Publish(topic, name, data)
+	h.mu.RLock()
+	relay := h.relay
+	h.mu.RUnlock()
+	if relay != nil {
+		relay(Event{Topic: topic, Name: name, Data: data})
+	}
+	return sent
+}
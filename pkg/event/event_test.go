@@ -0,0 +1,71 @@
+package event
+
+import "testing"
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+	a := h.Subscribe(1, "user:1", "course:1")
+	b := h.Subscribe(1, "course:1")
+
+	if sent := h.Publish("course:1", "seats", 3); sent != 2 {
+		t.Fatalf("want 2 subscribers received, got %d", sent)
+	}
+	if e := <-a.C; e.Topic != "course:1" || e.Name != "seats" || e.Data != 3 {
+		t.Errorf("unexpected event %+v", e)
+	}
+	<-b.C
+
+	//b is full and misses the event instead of blocking the publisher
+	h.Publish("course:1", "seats", 2)
+	if sent := h.Publish("course:1", "seats", 1); sent != 0 {
+		t.Errorf("want full subscribers skipped, got %d received", sent)
+	}
+
+	h.Add(b, "course:2")
+	h.Remove(b, "course:1")
+	if topics := h.Topics("course:"); len(topics) != 2 || topics[0] != "course:1" || topics[1] != "course:2" {
+		t.Errorf("want course:1 and course:2 subscribed, got %v", topics)
+	}
+	if n := h.Count(b); n != 1 {
+		t.Errorf("want 1 topic of b, got %d", n)
+	}
+
+	h.Unsubscribe(a)
+	h.Unsubscribe(b)
+	if h.HasSubscribers("course:1") || h.HasSubscribers("user:1") {
+		t.Errorf("topics are subscribed after unsubscribing")
+	}
+	if sent := h.Publish("user:1", "booking", nil); sent != 0 {
+		t.Errorf("want no subscribers, got %d", sent)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	h := NewHub()
+	s := h.Subscribe(1, "course:1")
+	relayed := []Event{}
+	h.SetRelay(func(e Event) { relayed = append(relayed, e) })
+
+	//publish only reaches this node
+	h.Publish("course:1", "seats", 1)
+	<-s.C
+	if len(relayed) != 0 {
+		t.Errorf("want published event not relayed, got %v", relayed)
+	}
+
+	//broadcast reaches this node and is relayed even without local subscribers
+	if sent := h.Broadcast("course:1", "seats", 2); sent != 1 {
+		t.Errorf("want 1 subscriber received, got %d", sent)
+	}
+	<-s.C
+	h.Broadcast("course:2", "seats", 3)
+	if len(relayed) != 2 || relayed[0].Topic != "course:1" || relayed[1].Data != 3 {
+		t.Errorf("unexpected relayed events %+v", relayed)
+	}
+
+	h.SetRelay(nil)
+	h.Broadcast("course:1", "seats", 4)
+	if len(relayed) != 2 {
+		t.Errorf("want no relay after it is unset, got %v", relayed)
+	}
+}
@@ -0,0 +1,78 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+const (
+	FormatCsv   = "csv"
+	FormatJsonl = "jsonl"
+)
+
+//utf-8 byte order mark, so that excel opens csv with chinese correctly
+const bom = "\ufeff"
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+//Record is a row to export. It is marshaled to json as is for json lines
+type Record interface {
+	CsvRecord() []string
+}
+
+//Writer streams records in csv or json lines, nothing is buffered beyond the
+//underlying writers
+type Writer struct {
+	format string
+	csv    *csv.Writer
+	json   *json.Encoder
+	w      io.Writer
+}
+
+func NewWriter(w io.Writer, format string, header []string) (*Writer, error) {
+	switch format {
+	case FormatCsv:
+		if _, err := io.WriteString(w, bom); err != nil {
+			return nil, err
+		}
+		cw := csv.NewWriter(w)
+		if err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		return &Writer{format: format, csv: cw, w: w}, nil
+	case FormatJsonl:
+		return &Writer{format: format, json: json.NewEncoder(w), w: w}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+func (w *Writer) Write(r Record) error {
+	if w.format == FormatCsv {
+		return w.csv.Write(r.CsvRecord())
+	}
+	return w.json.Encode(r)
+}
+
+//flush buffered csv data and, if possible, the underlying writer
+func (w *Writer) Flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := w.w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+//content type of the format
+func ContentType(format string) string {
+	if format == FormatCsv {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson; charset=utf-8"
+}
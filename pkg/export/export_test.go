@@ -0,0 +1,45 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+)
+
+type row struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func (r row) CsvRecord() []string {
+	return []string{string(rune('0' + r.ID)), r.Name}
+}
+
+func TestWriter(t *testing.T) {
+	rows := []row{{1, "张三"}, {2, "Li, Si"}}
+	cases := map[string]string{
+		FormatCsv:   bom + "id,name\n1,张三\n2,\"Li, Si\"\n",
+		FormatJsonl: `{"id":1,"name":"张三"}` + "\n" + `{"id":2,"name":"Li, Si"}` + "\n",
+	}
+	for format, want := range cases {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, format, []string{"id", "name"})
+		if err != nil {
+			t.Fatalf("new %s writer error: %v", format, err)
+		}
+		for _, r := range rows {
+			if err := w.Write(r); err != nil {
+				t.Fatalf("write %s error: %v", format, err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("flush %s error: %v", format, err)
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("%s: want %q, got %q", format, want, got)
+		}
+	}
+
+	if _, err := NewWriter(&bytes.Buffer{}, "xlsx", nil); err != ErrUnknownFormat {
+		t.Errorf("want ErrUnknownFormat, got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package ldapauth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var ErrInvalidCredentials = errors.New("invalid ldap credentials")
+
+type Config struct {
+	Addr           string
+	UserDNTemplate string
+	NicknameAttr   string
+	GroupAttr      string
+	Timeout        time.Duration
+}
+
+//directory entry of a bound user
+type Entry struct {
+	DN       string
+	Nickname string
+	Groups   []string
+}
+
+//bind to the directory as user and read the user's own entry
+func Bind(c Config, username, password string, entry *Entry) error {
+	//an empty password would be an unauthenticated bind which always succeeds
+	if username == "" || password == "" {
+		return ErrInvalidCredentials
+	}
+
+	conn, err := ldap.DialURL(c.Addr, ldap.DialWithDialer(&net.Dialer{Timeout: c.Timeout}))
+	if err != nil {
+		return fmt.Errorf("dial ldap server: %w", err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(c.Timeout)
+
+	dn := fmt.Sprintf(c.UserDNTemplate, escapeDN(username))
+	err = conn.Bind(dn, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return ErrInvalidCredentials
+	}
+	if err != nil {
+		return fmt.Errorf("ldap bind: %w", err)
+	}
+
+	req := ldap.NewSearchRequest(dn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1,
+		int(c.Timeout/time.Second), false, "(objectClass=*)", []string{c.NicknameAttr, c.GroupAttr}, nil)
+	result, err := conn.Search(req)
+	if err != nil {
+		return fmt.Errorf("ldap search user entry: %w", err)
+	}
+	if len(result.Entries) == 0 {
+		return ErrInvalidCredentials
+	}
+
+	*entry = Entry{
+		DN:       dn,
+		Nickname: result.Entries[0].GetAttributeValue(c.NicknameAttr),
+		Groups:   result.Entries[0].GetAttributeValues(c.GroupAttr),
+	}
+	return nil
+}
+
+//escape special characters of a DN attribute value, see RFC 4514
+func escapeDN(s string) string {
+	var b strings.Builder
+	for i, c := range s {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, c),
+			i == 0 && (c == ' ' || c == '#'),
+			i == len(s)-1 && c == ' ':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case c == 0:
+			b.WriteString(`\00`)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
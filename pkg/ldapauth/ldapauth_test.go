@@ -0,0 +1,62 @@
+package ldapauth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/pkg/ldapauth/ldaptest"
+)
+
+func TestBind(t *testing.T) {
+	s := ldaptest.NewServer(t, map[string]ldaptest.User{
+		"uid=zhangsan,ou=people,dc=example,dc=com": {
+			Password: "Passw0rd",
+			Nickname: "Zhang San",
+			Groups:   []string{"cn=teachers,ou=groups,dc=example,dc=com"},
+		},
+	})
+	c := Config{
+		Addr:           s.Addr(),
+		UserDNTemplate: "uid=%s,ou=people,dc=example,dc=com",
+		NicknameAttr:   "displayName",
+		GroupAttr:      "memberOf",
+		Timeout:        3 * time.Second,
+	}
+
+	entry := Entry{}
+	if err := Bind(c, "zhangsan", "Passw0rd", &entry); err != nil {
+		t.Fatalf("bind error: %v", err)
+	}
+	if entry.Nickname != "Zhang San" {
+		t.Errorf("want nickname %q, got %q", "Zhang San", entry.Nickname)
+	}
+	if len(entry.Groups) != 1 || entry.Groups[0] != "cn=teachers,ou=groups,dc=example,dc=com" {
+		t.Errorf("unexpected groups %v", entry.Groups)
+	}
+
+	for _, tc := range []struct{ username, password string }{
+		{"zhangsan", "wrong"},
+		{"lisi", "Passw0rd"},
+		{"zhangsan", ""},
+	} {
+		if err := Bind(c, tc.username, tc.password, &entry); err != ErrInvalidCredentials {
+			t.Errorf("bind %s/%s: want ErrInvalidCredentials, got %v", tc.username, tc.password, err)
+		}
+	}
+}
+
+func TestEscapeDN(t *testing.T) {
+	cases := map[string]string{
+		"zhangsan":     "zhangsan",
+		"a,b":          `a\,b`,
+		"#admin":       `\#admin`,
+		"x=y+z":        `x\=y\+z`,
+		" padded ":     `\ padded\ `,
+		`quote"back\\`: `quote\"back\\\\`,
+	}
+	for in, want := range cases {
+		if got := escapeDN(in); got != want {
+			t.Errorf("escapeDN(%q): want %q, got %q", in, want, got)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package ldaptest
+
+import (
+	"net"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+//an entry of the fake directory
+type User struct {
+	Password string
+	Nickname string
+	Groups   []string
+}
+
+//Server is an in-process ldap server which only supports simple bind and base object search.
+//The nickname is returned as displayName and the groups as memberOf
+type Server struct {
+	listener net.Listener
+	users    map[string]User //key is dn
+}
+
+//start a server closed when the test finishes
+func NewServer(t *testing.T, users map[string]User) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen error: %v", err)
+	}
+	s := &Server{listener: l, users: users}
+	go s.serve()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+//ldap url of the server
+func (s *Server) Addr() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	boundDN := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		msgID := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if user, ok := s.users[dn]; ok && user.Password == password {
+				code = ldap.LDAPResultSuccess
+				boundDN = dn
+			}
+			conn.Write(response(msgID, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			dn := op.Children[0].Value.(string)
+			user, ok := s.users[dn]
+			if ok && dn == boundDN {
+				entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+				entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, ""))
+				attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+				attrs.AppendChild(attribute("displayName", user.Nickname))
+				attrs.AppendChild(attribute("memberOf", user.Groups...))
+				entry.AppendChild(attrs)
+				conn.Write(envelope(msgID, entry).Bytes())
+			}
+			code := uint16(ldap.LDAPResultSuccess)
+			if !ok {
+				code = ldap.LDAPResultNoSuchObject
+			}
+			conn.Write(response(msgID, ldap.ApplicationSearchResultDone, code).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func envelope(msgID int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, ""))
+	packet.AppendChild(op)
+	return packet
+}
+
+func response(msgID int64, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return envelope(msgID, op)
+}
+
+func attribute(name string, values ...string) *ber.Packet {
+	attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+	set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+	for _, v := range values {
+		set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+	}
+	attr.AppendChild(set)
+	return attr
+}
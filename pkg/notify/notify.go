@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hollowdjj/course-selecting-sys/conf"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+//a message sent to user, such as password reset token
+type Message struct {
+	To      string
+	Subject string
+	Content string
+}
+
+//Sender delivers messages to users. Email, sms and so on can be plugged in by
+//implementing this interface, log and file sinks are used for local test
+type Sender interface {
+	Send(msg Message) error
+}
+
+var sender Sender = LogSender{}
+
+//Init sender according to conf.notify
+func InitSender() {
+	notifyConf := conf.GetNotify()
+	switch notifyConf.Sender {
+	case "file":
+		sender = NewFileSender(notifyConf.FilePath)
+	default:
+		sender = LogSender{}
+	}
+}
+
+//Get the sender in use
+func GetSender() Sender {
+	return sender
+}
+
+//Replace the sender in use, mainly for test
+func SetSender(s Sender) {
+	sender = s
+}
+
+//LogSender writes messages to logger
+type LogSender struct{}
+
+func (LogSender) Send(msg Message) error {
+	logger.GetInstance().WithFields(logrus.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"content": msg.Content,
+	}).Infoln("send message")
+	return nil
+}
+
+//FileSender appends messages to a local file
+type FileSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+func (f *FileSender) Send(msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "%s\t%s\t%s\t%s\n",
+		time.Now().Format("2006-01-02 15:04:05"), msg.To, msg.Subject, msg.Content)
+	return err
+}
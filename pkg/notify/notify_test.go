@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify")
+	s := NewFileSender(path)
+	msgs := []Message{
+		{To: "student01", Subject: "password reset", Content: "token1"},
+		{To: "teacher01", Subject: "password reset", Content: "token2"},
+	}
+	for _, msg := range msgs {
+		if err := s.Send(msg); err != nil {
+			t.Fatalf("send message error: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read file error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != len(msgs) {
+		t.Fatalf("want %d lines, got %d", len(msgs), len(lines))
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, msgs[i].To+"\t"+msgs[i].Subject+"\t"+msgs[i].Content) {
+			t.Errorf("unexpected line %q", line)
+		}
+	}
+}
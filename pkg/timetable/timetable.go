@@ -0,0 +1,75 @@
+package timetable
+
+import "sort"
+
+const (
+	MaxPeriod = 14 //periods of a day
+	MaxWeek   = 30 //weeks of a term
+)
+
+//a weekly meeting of a course. Periods and weeks are 1-based and inclusive
+type Slot struct {
+	Weekday     int `json:"weekday"` //1 is monday and 7 is sunday
+	StartPeriod int `json:"start_period"`
+	EndPeriod   int `json:"end_period"`
+	StartWeek   int `json:"start_week"`
+	EndWeek     int `json:"end_week"`
+}
+
+//whether the fields are in range
+func (s Slot) Valid() bool {
+	return s.Weekday >= 1 && s.Weekday <= 7 &&
+		s.StartPeriod >= 1 && s.StartPeriod <= s.EndPeriod && s.EndPeriod <= MaxPeriod &&
+		s.StartWeek >= 1 && s.StartWeek <= s.EndWeek && s.EndWeek <= MaxWeek
+}
+
+//whether two slots meet at the same time in some week
+func (s Slot) Overlaps(o Slot) bool {
+	return s.Weekday == o.Weekday &&
+		s.StartPeriod <= o.EndPeriod && o.StartPeriod <= s.EndPeriod &&
+		s.StartWeek <= o.EndWeek && o.StartWeek <= s.EndWeek
+}
+
+//whether the slot meets in week
+func (s Slot) InWeek(week int) bool {
+	return s.StartWeek <= week && week <= s.EndWeek
+}
+
+//a course meeting in the timetable
+type Entry struct {
+	Slot
+	CourseID   uint64 `json:"course_id"`
+	CourseName string `json:"course_name"`
+	Location   string `json:"location"`
+}
+
+//a column of the weekly grid
+type Day struct {
+	Weekday int     `json:"weekday"`
+	Entries []Entry `json:"entries"`
+}
+
+//arrange entries into a weekly grid of 7 days, each day ordered by start period.
+//week 0 means all weeks of the term
+func Grid(entries []Entry, week int) []Day {
+	days := make([]Day, 7)
+	for i := range days {
+		days[i] = Day{Weekday: i + 1, Entries: []Entry{}}
+	}
+	for _, e := range entries {
+		if e.Weekday < 1 || e.Weekday > 7 || (week != 0 && !e.InWeek(week)) {
+			continue
+		}
+		days[e.Weekday-1].Entries = append(days[e.Weekday-1].Entries, e)
+	}
+	for _, day := range days {
+		entries := day.Entries
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].StartPeriod != entries[j].StartPeriod {
+				return entries[i].StartPeriod < entries[j].StartPeriod
+			}
+			return entries[i].StartWeek < entries[j].StartWeek
+		})
+	}
+	return days
+}
@@ -0,0 +1,70 @@
+package timetable
+
+import "testing"
+
+func TestOverlaps(t *testing.T) {
+	base := Slot{Weekday: 1, StartPeriod: 3, EndPeriod: 4, StartWeek: 1, EndWeek: 8}
+	cases := []struct {
+		slot Slot
+		want bool
+	}{
+		{Slot{1, 3, 4, 1, 8}, true},
+		{Slot{1, 4, 5, 8, 16}, true},
+		{Slot{1, 1, 2, 1, 16}, false},
+		{Slot{1, 5, 6, 1, 16}, false},
+		{Slot{1, 3, 4, 9, 16}, false},
+		{Slot{2, 3, 4, 1, 8}, false},
+	}
+	for _, c := range cases {
+		if got := base.Overlaps(c.slot); got != c.want {
+			t.Errorf("%v overlaps %v: want %v, got %v", base, c.slot, c.want, got)
+		}
+		if got := c.slot.Overlaps(base); got != c.want {
+			t.Errorf("%v overlaps %v: want %v, got %v", c.slot, base, c.want, got)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	cases := map[Slot]bool{
+		{1, 1, 2, 1, 16}:    true,
+		{7, 14, 14, 30, 30}: true,
+		{0, 1, 2, 1, 16}:    false,
+		{8, 1, 2, 1, 16}:    false,
+		{1, 3, 2, 1, 16}:    false,
+		{1, 1, 15, 1, 16}:   false,
+		{1, 1, 2, 9, 8}:     false,
+		{1, 1, 2, 0, 8}:     false,
+	}
+	for slot, want := range cases {
+		if got := slot.Valid(); got != want {
+			t.Errorf("%v valid: want %v, got %v", slot, want, got)
+		}
+	}
+}
+
+func TestGrid(t *testing.T) {
+	entries := []Entry{
+		{Slot: Slot{1, 5, 6, 1, 16}, CourseID: 1},
+		{Slot: Slot{1, 1, 2, 1, 8}, CourseID: 2},
+		{Slot: Slot{3, 1, 2, 9, 16}, CourseID: 3},
+	}
+	days := Grid(entries, 0)
+	if len(days) != 7 {
+		t.Fatalf("want 7 days, got %d", len(days))
+	}
+	if len(days[0].Entries) != 2 || days[0].Entries[0].CourseID != 2 || days[0].Entries[1].CourseID != 1 {
+		t.Errorf("monday not ordered by period: %v", days[0].Entries)
+	}
+	if len(days[2].Entries) != 1 {
+		t.Errorf("want 1 entry on wednesday, got %v", days[2].Entries)
+	}
+
+	days = Grid(entries, 10)
+	if len(days[0].Entries) != 1 || days[0].Entries[0].CourseID != 1 {
+		t.Errorf("week 10 monday: %v", days[0].Entries)
+	}
+	if len(days[2].Entries) != 1 {
+		t.Errorf("week 10 wednesday: %v", days[2].Entries)
+	}
+}
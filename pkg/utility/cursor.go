@@ -0,0 +1,35 @@
+package utility
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+//Cursor points at a row of a keyset paginated list. It is handed to client as an
+//opaque string, client should never build it by hand
+type Cursor struct {
+	ID      uint64 `json:"i"`           //primary key of the row
+	Sort    string `json:"s,omitempty"` //sort column the cursor is built for
+	Value   string `json:"v,omitempty"` //sort column value of the row, empty when sorted by primary key
+	Forward bool   `json:"f"`           //true for next page, false for previous page
+}
+
+func EncodeCursor(c Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	c := Cursor{}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err = json.Unmarshal(data, &c); err != nil || c.ID == 0 {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
@@ -0,0 +1,25 @@
+package utility
+
+import "testing"
+
+func TestCursor(t *testing.T) {
+	cursors := []Cursor{
+		{ID: 1, Forward: true},
+		{ID: 80000, Sort: "nickname", Value: "Zhang_%San", Forward: false},
+	}
+	for _, c := range cursors {
+		got, err := DecodeCursor(EncodeCursor(c))
+		if err != nil {
+			t.Fatalf("decode cursor %+v error: %v", c, err)
+		}
+		if got != c {
+			t.Errorf("want %+v, got %+v", c, got)
+		}
+	}
+
+	for _, s := range []string{"", "not base64!", EncodeCursor(Cursor{})} {
+		if _, err := DecodeCursor(s); err != ErrInvalidCursor {
+			t.Errorf("decode %q: want ErrInvalidCursor, got %v", s, err)
+		}
+	}
+}
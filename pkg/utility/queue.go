@@ -1,50 +1,117 @@
 package utility
 
+import "sync"
+
+//并发安全的队列。capacity为0时不限制长度
 type Queue struct {
-	slots []interface{}
+	mu       sync.Mutex
+	slots    []interface{}
+	capacity int
+	ready    chan struct{} //有元素入队时通知等待的消费者
 }
 
 //将元素插入到队列尾部。注意，这里的参数不能设置为*Item类型
 //因为，空的interface的动态类型是在赋值的时候隐式确定的。所以，这里
 //必须是值类型，从而才能确定Item的动态类型。
+//有界队列已满时仍然插入，需要限制长度时使用TryPush
 func (q *Queue) Push(i interface{}) {
+	q.mu.Lock()
+	q.slots = append(q.slots, i)
+	q.mu.Unlock()
+	q.notify()
+}
+
+//队列未满时将元素插入到队列尾部，返回是否插入成功
+func (q *Queue) TryPush(i interface{}) bool {
+	q.mu.Lock()
+	if q.capacity > 0 && len(q.slots) >= q.capacity {
+		q.mu.Unlock()
+		return false
+	}
 	q.slots = append(q.slots, i)
+	q.mu.Unlock()
+	q.notify()
+	return true
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
 }
 
-//首元素出队
-func (q *Queue) Pop() *interface{} {
-	res := &q.slots[0]
+//首元素出队，队列为空时ok为false。返回值而不是指向底层数组的指针，出队后该位置可能被其他协程复用
+func (q *Queue) Pop() (v interface{}, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.slots) == 0 {
+		return nil, false
+	}
+	v = q.slots[0]
+	q.slots[0] = nil
 	q.slots = q.slots[1:]
+	return v, true
+}
+
+//最多出队n个元素，队列为空时返回空切片
+func (q *Queue) PopN(n int) []interface{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n = Min(n, len(q.slots))
+	res := make([]interface{}, n)
+	copy(res, q.slots[:n])
+	//清空已出队的位置，避免底层数组继续引用这些元素
+	for i := 0; i < n; i++ {
+		q.slots[i] = nil
+	}
+	q.slots = q.slots[n:]
 	return res
 }
 
+//有元素入队时可读。多个消费者共用时只有一个会被唤醒，消费者应在队列为空后再等待
+func (q *Queue) Ready() <-chan struct{} {
+	return q.ready
+}
+
 //判断队列是否为空
 func (q *Queue) Empty() bool {
-	n := len(q.slots)
-	if n > 0 {
-		return false
-	}
-
-	return true
+	return q.Size() == 0
 }
 
-//返回队列的首元素
-func (q *Queue) Front() *interface{} {
-	return &q.slots[0]
+//返回队列的首元素，队列为空时ok为false
+func (q *Queue) Front() (v interface{}, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.slots) == 0 {
+		return nil, false
+	}
+	return q.slots[0], true
 }
 
-//返回队列的尾元素
-func (q *Queue) Back() *interface{} {
-	return &q.slots[len(q.slots)-1]
+//返回队列的尾元素，队列为空时ok为false
+func (q *Queue) Back() (v interface{}, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.slots) == 0 {
+		return nil, false
+	}
+	return q.slots[len(q.slots)-1], true
 }
 
 //返回队列中元素个数
 func (q *Queue) Size() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
 	return len(q.slots)
 }
 
 //CreateQueue 创建一个空的队列
 func CreateQueue() *Queue {
-	emptyQueue := new(Queue)
-	return emptyQueue
+	return CreateBoundedQueue(0)
+}
+
+//CreateBoundedQueue 创建一个最多容纳capacity个元素的空队列
+func CreateBoundedQueue(capacity int) *Queue {
+	return &Queue{capacity: capacity, ready: make(chan struct{}, 1)}
 }
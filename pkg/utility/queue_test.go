@@ -0,0 +1,79 @@
+package utility
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	q := CreateBoundedQueue(2)
+	if !q.TryPush(1) || !q.TryPush(2) {
+		t.Fatalf("push to a non-full queue fail")
+	}
+	if q.TryPush(3) {
+		t.Fatalf("push to a full queue succ")
+	}
+	select {
+	case <-q.Ready():
+	default:
+		t.Fatalf("queue is not ready after push")
+	}
+	if v, ok := q.Front(); !ok || v != 1 {
+		t.Fatalf("want front 1, got %v", v)
+	}
+	if v, ok := q.Back(); !ok || v != 2 {
+		t.Fatalf("want back 2, got %v", v)
+	}
+	if got := q.PopN(5); len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("want [1 2], got %v", got)
+	}
+	if !q.Empty() {
+		t.Fatalf("queue is not empty after popping all")
+	}
+	if _, ok := q.Pop(); ok {
+		t.Fatalf("pop from an empty queue succ")
+	}
+	if _, ok := q.Front(); ok {
+		t.Fatalf("front of an empty queue found")
+	}
+	if _, ok := q.Back(); ok {
+		t.Fatalf("back of an empty queue found")
+	}
+}
+
+func TestQueueConcurrent(t *testing.T) {
+	const producers, n = 8, 1000
+	q := CreateQueue()
+	wg := sync.WaitGroup{}
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				q.Push(i)
+			}
+		}()
+	}
+
+	var popped int64
+	done := sync.WaitGroup{}
+	for c := 0; c < producers; c++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			for atomic.LoadInt64(&popped) < producers*n {
+				atomic.AddInt64(&popped, int64(len(q.PopN(10))))
+				//single pops race with batch pops of other consumers
+				if _, ok := q.Pop(); ok {
+					atomic.AddInt64(&popped, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	done.Wait()
+	if popped != producers*n || !q.Empty() {
+		t.Fatalf("want %d popped and empty queue, got %d popped and %d left", producers*n, popped, q.Size())
+	}
+}
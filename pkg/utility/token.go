@@ -2,17 +2,68 @@ package utility
 
 import (
 	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
 	"io"
+	"math/big"
 	"strconv"
 	"time"
 )
 
-//time + md5生成随机token
+//time + random bytes + md5生成随机token。仅使用时间的话，同一秒内登录的用户会拿到相同的token
 func GenerateToken() string {
-	currTime := time.Now().Unix()
+	currTime := time.Now().UnixNano()
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
 	h := md5.New()
 	io.WriteString(h, strconv.FormatInt(currTime, 10))
+	h.Write(nonce)
 	token := fmt.Sprintf("%x", h.Sum(nil))
 	return token
 }
+
+//sha256 digest of a token, tokens which are persisted to db are stored hashed
+func HashToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+//generate a random password which satisfies PasswordCheck
+func GeneratePassword(n int) string {
+	const (
+		lower = "abcdefghijkmnpqrstuvwxyz"
+		upper = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+		digit = "23456789"
+		all   = lower + upper + digit
+	)
+	buf := make([]byte, n)
+	for i := range buf {
+		charset := all
+		switch i {
+		case 0:
+			charset = lower
+		case 1:
+			charset = upper
+		case 2:
+			charset = digit
+		}
+		buf[i] = charset[randIntn(len(charset))]
+	}
+	//shuffle so that the lower/upper/digit chars are not always at the head
+	for i := len(buf) - 1; i > 0; i-- {
+		j := randIntn(i + 1)
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return string(buf)
+}
+
+//uniform random int in [0, n). rand.Int draws again when out of range, so unlike a byte modulo n
+//there is no bias towards small values
+func randIntn(n int) int {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		//the system random source is broken, a predictable password must not be returned
+		panic(err)
+	}
+	return int(v.Int64())
+}
@@ -1,8 +1,22 @@
 package utility
 
+import "strings"
+
 func Min(a, b int) int {
 	if a < b {
 		return a
 	}
 	return b
 }
+
+func Max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+//escape wildcards of sql LIKE pattern, so that user input is matched literally
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -1,7 +1,42 @@
 package utility
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/astaxie/beego/validation"
+)
 
 func TestMaxMath(t *testing.T) {
 	//MaxMath()
 }
+
+func TestRandIntn(t *testing.T) {
+	const n = 7
+	seen := make([]int, n)
+	for i := 0; i < 700; i++ {
+		v := randIntn(n)
+		if v < 0 || v >= n {
+			t.Fatalf("want value in [0, %d), got %d", n, v)
+		}
+		seen[v]++
+	}
+	for v, count := range seen {
+		if count == 0 {
+			t.Errorf("value %d is never drawn", v)
+		}
+	}
+}
+
+func TestGeneratePassword(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		password := GeneratePassword(12)
+		if len(password) != 12 {
+			t.Fatalf("want length 12, got %q", password)
+		}
+		v := &validation.Validation{}
+		PasswordCheck(v, password, "Password")
+		if v.HasErrors() {
+			t.Fatalf("generated password %q does not pass PasswordCheck", password)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/conf"
+	"github.com/hollowdjj/course-selecting-sys/pkg/app"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/event"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	eventsURL       = "/api/v1/proxy/events"
+	relayBuffer     = 1024 //batches waiting to be relayed, more are dropped
+	maxRelayedBatch = 256  //events sent in one request
+)
+
+//events to relay and the node they come from, which does not get them back
+type relayedEvents struct {
+	from   string
+	events []event.Event
+}
+
+var relayQueue = make(chan relayedEvents, relayBuffer)
+
+//relay events broadcast on this node to the other nodes. Other nodes send their events to the main
+//host, and the main host sends them on to every registered peer, so watchers get events of the
+//whole cluster on whichever node they connect to
+func StartEventRelay() {
+	event.GetHub().SetRelay(func(e event.Event) {
+		relay(relayedEvents{from: conf.GetApp().Host, events: []event.Event{e}})
+	})
+	go func() {
+		for batch := range relayQueue {
+			//send events queued meanwhile from the same node in one request
+			for len(batch.events) < maxRelayedBatch && len(relayQueue) > 0 {
+				next := <-relayQueue
+				if next.from != batch.from {
+					sendEvents(batch)
+					batch = next
+					continue
+				}
+				batch.events = append(batch.events, next.events...)
+			}
+			sendEvents(batch)
+		}
+	}()
+}
+
+//queue events to relay without blocking the publisher
+func relay(batch relayedEvents) {
+	select {
+	case relayQueue <- batch:
+	default:
+		logger.GetInstance().WithField("events", len(batch.events)).Errorln("relay queue full, events dropped")
+	}
+}
+
+//send the events to the main host, or to the peers except the sender if this is the main host
+func sendEvents(batch relayedEvents) {
+	self, mainHost := conf.GetApp().Host, conf.GetApp().MainHost
+	nodes := []string{mainHost}
+	if self == mainHost {
+		nodes = nodes[:0]
+		for _, peer := range httpPool.GetPeers() {
+			if peer != self && peer != batch.from {
+				nodes = append(nodes, peer)
+			}
+		}
+	}
+	if len(nodes) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(batch.events)
+	if err != nil {
+		logger.GetInstance().WithField("err", err).Errorln("marshal relayed events error")
+		return
+	}
+	client := http.Client{Timeout: 5 * time.Second}
+	for _, node := range nodes {
+		url := fmt.Sprintf("http://%s:%d%s", node, conf.GetServer().HttpPort, eventsURL)
+		resp, err := client.Post(url, "application/json;charset=utf-8", bytes.NewReader(body))
+		if err != nil {
+			logger.GetInstance().WithFields(logrus.Fields{
+				"url": url,
+				"err": err,
+			}).Errorln("relay events error")
+			continue
+		}
+		resp.Body.Close()
+	}
+}
+
+//whether host is the main host or a registered peer
+func isNode(host string) bool {
+	if host == conf.GetApp().MainHost {
+		return true
+	}
+	for _, peer := range httpPool.GetPeers() {
+		if peer == host {
+			return true
+		}
+	}
+	return false
+}
+
+//receive events relayed by another node and publish them to watchers on this node
+func ReceiveEvents(c *gin.Context) {
+	appG := app.Gin{C: c}
+	from := c.ClientIP()
+	if !isNode(from) {
+		logger.GetInstance().WithField("client", from).Errorln("relayed events from unknown node")
+		appG.Response(http.StatusForbidden, constval.PermDenied, nil)
+		return
+	}
+
+	//data is kept as it is sent, watchers encode it again as json
+	received := []struct {
+		Topic string          `json:"topic"`
+		Name  string          `json:"name"`
+		Data  json.RawMessage `json:"data"`
+	}{}
+	if err := c.ShouldBindJSON(&received); err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"client": from,
+			"err":    err,
+		}).Errorln("relayed events invalid")
+		appG.Response(http.StatusBadRequest, constval.ParamInvalid, nil)
+		return
+	}
+	events := make([]event.Event, 0, len(received))
+	for _, e := range received {
+		event.GetHub().Publish(e.Topic, e.Name, e.Data)
+		events = append(events, event.Event{Topic: e.Topic, Name: e.Name, Data: e.Data})
+	}
+	if conf.GetApp().Host == conf.GetApp().MainHost && len(events) > 0 {
+		relay(relayedEvents{from: from, events: events})
+	}
+	appG.Response(http.StatusOK, constval.OK, nil)
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/conf"
+	"github.com/hollowdjj/course-selecting-sys/pkg/app"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+//header of a request forwarded by another node, such a request is never forwarded again
+const ForwardedHeader = "X-Forwarded-Node"
+
+//whether the request is forwarded by another node
+func IsForwarded(c *gin.Context) bool {
+	return c.GetHeader(ForwardedHeader) != ""
+}
+
+//forward the request to the node which holds its data and copy the response. Nodes listen on the
+//same port
+func Forward(c *gin.Context, node string) {
+	appG := app.Gin{C: c}
+	url := fmt.Sprintf("http://%s:%d%s", node, conf.GetServer().HttpPort, c.Request.URL.RequestURI())
+	req, err := http.NewRequestWithContext(c.Request.Context(), c.Request.Method, url, c.Request.Body)
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"url": url,
+			"err": err,
+		}).Errorln("build forwarded request error")
+		appG.Response(http.StatusInternalServerError, constval.UnknownError, nil)
+		return
+	}
+	req.Header.Set("Authorization", c.GetHeader("Authorization"))
+	req.Header.Set("Content-Type", c.GetHeader("Content-Type"))
+	req.Header.Set(ForwardedHeader, conf.GetApp().Host)
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"url": url,
+			"err": err,
+		}).Errorln("request peer error")
+		appG.Response(http.StatusBadGateway, constval.UnknownError, nil)
+		return
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.GetInstance().WithField("err", err).Errorln("read resp body error")
+		appG.Response(http.StatusBadGateway, constval.UnknownError, nil)
+		return
+	}
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), data)
+}
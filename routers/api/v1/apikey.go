@@ -0,0 +1,112 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	middleware "github.com/hollowdjj/course-selecting-sys/middleware/token"
+	"github.com/hollowdjj/course-selecting-sys/models"
+	"github.com/hollowdjj/course-selecting-sys/pkg/app"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+//@Summary mint an api key, admin only. The raw key is only returned here
+//@Produce json
+//@Param name query string false "Name"
+//@Param scopes query []string false "Scopes"
+//@Param expires_in query int false "ExpiresIn"
+//@Success 200 {string} json "{"code":200,"data":{key,api_key},"msg":{"ok"}}"
+//@Router /api/v1/auth/api_keys/create [post]
+func CreateApiKey(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.CreateApiKeyForm
+	)
+	admin := c.MustGet(middleware.UserInfoKey).(*models.UserInfo)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"name":   form.Name,
+			"scopes": form.Scopes,
+		}).Infoln("create api key form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	//create api key
+	var (
+		rawKey string
+		apiKey models.ApiKey
+	)
+	httpCode, errCode = form.CreateApiKey(admin.UserID, &rawKey, &apiKey)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"name": form.Name,
+			"msg":  constval.GetErrCodeMsg(errCode),
+		}).Infoln("create api key fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	logger.GetInstance().WithFields(logrus.Fields{
+		"key_id":   apiKey.KeyID,
+		"name":     apiKey.Name,
+		"scopes":   apiKey.Scopes,
+		"owner_id": admin.UserID,
+	}).Infoln("create api key succ")
+	appG.Response(httpCode, errCode, map[string]interface{}{"key": rawKey, "api_key": apiKey})
+}
+
+//@Summary list api keys, admin only
+//@Produce json
+//@Success 200 {string} json "{"code":200,"data":{api_key_list},"msg":{"ok"}}"
+//@Router /api/v1/auth/api_keys [get]
+func GetApiKeys(c *gin.Context) {
+	appG := app.Gin{C: c}
+
+	apiKeys := []models.ApiKey{}
+	httpCode, errCode := models.GetApiKeys(&apiKeys)
+	if errCode != constval.OK {
+		logger.GetInstance().Infoln("get api keys fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	appG.Response(httpCode, errCode, map[string]interface{}{"api_key_list": apiKeys})
+}
+
+//@Summary revoke an api key, admin only
+//@Produce json
+//@Param key_id query uint64 false "KeyID"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/auth/api_keys/revoke [post]
+func RevokeApiKey(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.RevokeApiKeyForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("key_id", form.KeyID).Infoln("revoke api key form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	//revoke api key
+	httpCode, errCode = form.RevokeApiKey()
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"key_id": form.KeyID,
+			"msg":    constval.GetErrCodeMsg(errCode),
+		}).Infoln("revoke api key fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	logger.GetInstance().WithField("key_id", form.KeyID).Infoln("revoke api key succ")
+	appG.Response(httpCode, errCode, nil)
+}
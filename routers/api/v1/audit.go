@@ -0,0 +1,62 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/middleware/requestid"
+	middleware "github.com/hollowdjj/course-selecting-sys/middleware/token"
+	"github.com/hollowdjj/course-selecting-sys/models"
+	"github.com/hollowdjj/course-selecting-sys/pkg/app"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+)
+
+//build the actor of current request for audit log from the login user. Routes writing audit log
+//must use middleware.Token, so that no anonymous change is recorded
+func actorOf(c *gin.Context) models.Actor {
+	return models.Actor{
+		UserID:    c.MustGet(middleware.UserInfoKey).(*models.UserInfo).UserID,
+		RequestID: c.GetString(requestid.Key),
+		ClientIP:  c.ClientIP(),
+	}
+}
+
+//@Summary query audit log, admin only
+//@Produce json
+//@Param actor_id query uint64 false "ActorID"
+//@Param action query string false "Action"
+//@Param target_type query string false "TargetType"
+//@Param target_id query string false "TargetID"
+//@Param start_time query int64 false "StartTime"
+//@Param end_time query int64 false "EndTime"
+//@Param offset query int false "Offset"
+//@Param limit query int false "Limit, 0 or larger than MaxPageSize means MaxPageSize"
+//@Success 200 {string} json "{"code":200,"data":{audit_list,total},"msg":{"ok"}}"
+//@Router /api/v1/audit/list [get]
+func GetAuditLogs(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.GetAuditLogForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("form", form).Infoln("get audit log form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	//query audit log
+	var (
+		logs  []models.AuditLog
+		total int64
+	)
+	httpCode, errCode = form.GetAuditLogs(&logs, &total)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("form", form).Infoln("get audit log fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	appG.Response(httpCode, errCode, map[string]interface{}{"audit_list": logs, "total": total})
+}
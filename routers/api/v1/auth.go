@@ -1,15 +1,15 @@
 package v1
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/hollowdjj/course-selecting-sys/cache"
+	middleware "github.com/hollowdjj/course-selecting-sys/middleware/token"
 	"github.com/hollowdjj/course-selecting-sys/models"
 	"github.com/hollowdjj/course-selecting-sys/pkg/app"
 	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
 	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/utility"
 	"github.com/sirupsen/logrus"
 )
 
@@ -37,8 +37,8 @@ func Login(c *gin.Context) {
 	}
 
 	//try login
-	var token *string
-	httpCode, errCode = form.Login(token)
+	var token string
+	httpCode, errCode = form.Login(&token, c.ClientIP(), c.Request.UserAgent())
 	if errCode != constval.OK {
 		logger.GetInstance().WithFields(logrus.Fields{
 			"username": form.Username,
@@ -50,7 +50,7 @@ func Login(c *gin.Context) {
 
 	//response token to client
 	logger.GetInstance().WithField("user", form.Username).Infoln("user login succ")
-	c.Header("Authorization", *token)
+	c.Header("Authorization", token)
 	appG.Response(httpCode, errCode, nil)
 }
 
@@ -58,34 +58,25 @@ func Login(c *gin.Context) {
 func Logout(c *gin.Context) {
 	appG := app.Gin{C: c}
 
-	//get token
+	//get token and user
 	token := c.GetHeader("Authorization")
-
-	//del cache
-	groupCacheToken := cache.GetGroupCache("login")
-	if groupCacheToken == nil {
-		appG.Response(http.StatusUnauthorized, constval.LoginRequired, nil)
-		return
-	}
-	val, _ := groupCacheToken.Get(token, cache.Option{
-		FromLocal:  true,
-		FromPeer:   false,
-		FromGetter: false,
-	})
-	if val.Len() == 0 {
-		appG.Response(http.StatusUnauthorized, constval.LoginRequired, nil)
+	userInfo := &models.UserInfo{}
+	httpCode, errCode := models.GetUserInfoByToken(token, userInfo)
+	if errCode != constval.OK {
+		appG.Response(httpCode, errCode, nil)
 		return
 	}
 
-	//unmarshal user info to get username
-	userInfo := &models.UserInfo{}
-	err := json.Unmarshal(val.ByteSlice(), userInfo)
+	//del session, keep other sessions of the user alive
+	err := models.RevokeToken(token)
 	if err != nil {
-		logger.GetInstance().WithField("err", err).Errorln("json unmarshal fail")
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user": userInfo.Username,
+			"err":  err,
+		}).Errorln("user logout fail")
+		appG.Response(http.StatusInternalServerError, constval.UnknownError, nil)
+		return
 	}
-	//del cache
-	groupCacheToken.Del(token)
-	groupCacheToken.Del(userInfo.Username)
 	appG.Response(http.StatusOK, constval.OK, nil)
 	logger.GetInstance().WithField("user", userInfo.Username).Infoln("user logout succ")
 }
@@ -97,30 +88,226 @@ func WhoAmI(c *gin.Context) {
 	//get token
 	token := c.GetHeader("Authorization")
 
-	//look up cache
-	groupCacheToken := cache.GetGroupCache("login")
-	if groupCacheToken == nil {
-		appG.Response(http.StatusUnauthorized, constval.LoginRequired, nil)
+	//look up user info
+	userInfo := &models.UserInfo{}
+	httpCode, errCode := models.GetUserInfoByToken(token, userInfo)
+	if errCode != constval.OK {
+		appG.Response(httpCode, errCode, nil)
 		return
 	}
-	val, _ := groupCacheToken.Get(token, cache.Option{
-		FromLocal:  true,
-		FromPeer:   false,
-		FromGetter: false,
-	})
-	if val.Len() == 0 {
-		appG.Response(http.StatusUnauthorized, constval.LoginRequired, nil)
+	if err := models.LoadProfile(userInfo); err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": userInfo.UserID,
+			"err":     err,
+		}).Errorln("query user profile error")
+		appG.Response(http.StatusInternalServerError, constval.UnknownError, nil)
 		return
 	}
 
-	//unmarshal user info
-	userInfo := &models.UserInfo{}
-	err := json.Unmarshal(val.ByteSlice(), userInfo)
-	if err != nil {
-		logger.GetInstance().WithField("err", err).Errorln("json unmarshal fail")
-		appG.Response(http.StatusInternalServerError, constval.UnknownError, nil)
+	appG.Response(http.StatusOK, constval.OK, map[string]interface{}{"user_info": userInfo})
+}
+
+//@Summary list active sessions of current user
+//@Produce json
+//@Success 200 {string} json "{"code":200,"data":{session_list},"msg":{"ok"}}"
+//@Router /api/v1/auth/sessions [get]
+func GetSessions(c *gin.Context) {
+	appG := app.Gin{C: c}
+	userInfo := c.MustGet(middleware.UserInfoKey).(*models.UserInfo)
+
+	sessions := []models.Session{}
+	httpCode, errCode := models.GetUserSessions(userInfo.UserID, c.GetHeader("Authorization"), &sessions)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("user_id", userInfo.UserID).Infoln("get sessions fail")
+		appG.Response(httpCode, errCode, nil)
 		return
 	}
 
-	appG.Response(http.StatusOK, constval.OK, map[string]interface{}{"user_info": userInfo})
+	appG.Response(httpCode, errCode, map[string]interface{}{"session_list": sessions})
+}
+
+//@Summary revoke one session of current user
+//@Produce json
+//@Param session_id query uint64 false "SessionID"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/auth/sessions/revoke [post]
+func RevokeSession(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.RevokeSessionForm
+	)
+	userInfo := c.MustGet(middleware.UserInfoKey).(*models.UserInfo)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("session_id", form.SessionID).Infoln("revoke session form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	//revoke session
+	httpCode, errCode = form.RevokeSession(userInfo.UserID)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id":    userInfo.UserID,
+			"session_id": form.SessionID,
+			"msg":        constval.GetErrCodeMsg(errCode),
+		}).Infoln("revoke session fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	logger.GetInstance().WithFields(logrus.Fields{
+		"user_id":    userInfo.UserID,
+		"session_id": form.SessionID,
+	}).Infoln("revoke session succ")
+	appG.Response(httpCode, errCode, nil)
+}
+
+//@Summary force logout a user everywhere, admin only
+//@Produce json
+//@Param user_id query uint64 false "UserID"
+//@Success 200 {string} json "{"code":200,"data":{revoked},"msg":{"ok"}}"
+//@Router /api/v1/auth/sessions/revoke_all [post]
+func RevokeAllSessions(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.RevokeAllSessionsForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("user_id", form.UserID).Infoln("revoke all sessions form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	//revoke sessions
+	var revoked int64
+	httpCode, errCode = form.RevokeAllSessions(&revoked)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("user_id", form.UserID).Infoln("revoke all sessions fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	logger.GetInstance().WithFields(logrus.Fields{
+		"user_id": form.UserID,
+		"revoked": revoked,
+	}).Infoln("revoke all sessions succ")
+	appG.Response(httpCode, errCode, map[string]interface{}{"revoked": revoked})
+}
+
+//@Summary change password of current user
+//@Produce json
+//@Param old_password query string false "OldPassword"
+//@Param new_password query string false "NewPassword"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/auth/password/change [post]
+func ChangePassword(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.ChangePasswordForm
+	)
+	userInfo := c.MustGet(middleware.UserInfoKey).(*models.UserInfo)
+
+	//form validation
+	funcs := app.CustomFunc{
+		"PasswordCheck": utility.PasswordCheck,
+	}
+	httpCode, errCode := app.BindAndValidCustom(c, &form, funcs, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("user_id", userInfo.UserID).Infoln("change password form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	//change password
+	httpCode, errCode = form.ChangePassword(userInfo.UserID)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": userInfo.UserID,
+			"msg":     constval.GetErrCodeMsg(errCode),
+		}).Infoln("change password fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	logger.GetInstance().WithField("user_id", userInfo.UserID).Infoln("change password succ")
+	appG.Response(httpCode, errCode, nil)
+}
+
+//@Summary issue a one-time password reset token to user, admin only
+//@Produce json
+//@Param user_id query uint64 false "UserID"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/auth/password/reset_token [post]
+func IssuePasswordReset(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.IssuePasswordResetForm
+	)
+	admin := c.MustGet(middleware.UserInfoKey).(*models.UserInfo)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("user_id", form.UserID).Infoln("issue password reset form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	//issue reset token
+	httpCode, errCode = form.IssuePasswordReset(admin.UserID)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": form.UserID,
+			"msg":     constval.GetErrCodeMsg(errCode),
+		}).Infoln("issue password reset fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	logger.GetInstance().WithFields(logrus.Fields{
+		"user_id":   form.UserID,
+		"issuer_id": admin.UserID,
+	}).Infoln("issue password reset succ")
+	appG.Response(httpCode, errCode, nil)
+}
+
+//@Summary reset password by a one-time reset token
+//@Produce json
+//@Param token query string false "Token"
+//@Param new_password query string false "NewPassword"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/auth/password/reset [post]
+func ResetPassword(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.ResetPasswordForm
+	)
+
+	//form validation
+	funcs := app.CustomFunc{
+		"PasswordCheck": utility.PasswordCheck,
+	}
+	httpCode, errCode := app.BindAndValidCustom(c, &form, funcs, true)
+	if errCode != constval.OK {
+		logger.GetInstance().Infoln("reset password form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	//reset password
+	httpCode, errCode = form.ResetPassword()
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("msg", constval.GetErrCodeMsg(errCode)).Infoln("reset password fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	logger.GetInstance().Infoln("reset password succ")
+	appG.Response(httpCode, errCode, nil)
 }
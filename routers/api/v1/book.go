@@ -1,14 +1,26 @@
 package v1
 
 import (
+	"net/http"
+	"strconv"
+
 	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/conf"
+	middleware "github.com/hollowdjj/course-selecting-sys/middleware/token"
 	"github.com/hollowdjj/course-selecting-sys/models"
 	"github.com/hollowdjj/course-selecting-sys/pkg/app"
 	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
 	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/pkg/timetable"
 	"github.com/sirupsen/logrus"
 )
 
+//@Summary book a course. Only the student or an admin may book
+//@Produce json
+//@Param UserID query string false "UserID"
+//@Param CourseID query string false "CourseID"
+//@Success 200 {string} json "{"code":200,"data":{ticket},"msg":{"ok"}}"
+//@Router /api/v1/student/book_course [post]
 func BookCourse(c *gin.Context) {
 	var (
 		appG = app.Gin{C: c}
@@ -27,10 +39,205 @@ func BookCourse(c *gin.Context) {
 		return
 	}
 
-	//book course
-	httpCode, errCode = form.BookCourse()
+	if !actsFor(c, form.UserID) {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid":   form.UserID,
+			"courseid": form.CourseID,
+		}).Infoln("book course for another student")
+		appG.Response(http.StatusForbidden, constval.PermDenied, nil)
+		return
+	}
+
+	//book course. In async mode the booking is queued and a ticket is returned for polling
+	result := models.BookResult{}
+	ticket := models.Ticket{}
+	if conf.GetBooking().Async {
+		httpCode, errCode = form.BookCourseAsync(actorOf(c), &result, &ticket)
+	} else {
+		httpCode, errCode = form.BookCourse(actorOf(c), &result)
+	}
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid":   form.UserID,
+			"courseid": form.CourseID,
+			"msg":      constval.GetErrCodeMsg(errCode),
+		}).Infoln("book course fail")
+		appG.Response(httpCode, errCode, result)
+		return
+	}
+
+	logger.GetInstance().WithFields(logrus.Fields{
+		"userid":   form.UserID,
+		"courseid": form.CourseID,
+	}).Infoln("book course succ")
+	if ticket.Ticket != "" {
+		appG.Response(httpCode, errCode, map[string]string{"ticket": ticket.Ticket})
+		return
+	}
+	appG.Response(httpCode, errCode, nil)
+}
+
+//@Summary drop a booked course, the seat is given back. Only the student or an admin may drop
+//@Produce json
+//@Param UserID query string false "UserID"
+//@Param CourseID query string false "CourseID"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/student/drop_course [post]
+func DropCourse(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.DropCourseForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid":   form.UserID,
+			"courseid": form.CourseID,
+			"msg":      constval.GetErrCodeMsg(errCode),
+		}).Infoln("drop course form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	if !actsFor(c, form.UserID) {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid":   form.UserID,
+			"courseid": form.CourseID,
+		}).Infoln("drop course of another student")
+		appG.Response(http.StatusForbidden, constval.PermDenied, nil)
+		return
+	}
+
+	//drop course
+	httpCode, errCode = form.DropCourse(actorOf(c))
+	msg := "drop course succ"
+	if errCode != constval.OK {
+		msg = "drop course fail"
+	}
+	logger.GetInstance().WithFields(logrus.Fields{
+		"userid":   form.UserID,
+		"courseid": form.CourseID,
+		"msg":      constval.GetErrCodeMsg(errCode),
+	}).Infoln(msg)
+	appG.Response(httpCode, errCode, nil)
+}
+
+//@Summary weekly timetable of a student in the current term
+//@Produce json
+//@Param user_id query uint64 false "UserID"
+//@Param week query int false "Week, 0 means all weeks"
+//@Success 200 {string} json "{"code":200,"data":{timetable},"msg":{"ok"}}"
+//@Router /api/v1/student/timetable [get]
+func GetTimetable(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.GetTimetableForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("user_id", form.UserID).Infoln("get timetable form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	days := []timetable.Day{}
+	httpCode, errCode = form.GetTimetable(&days)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": form.UserID,
+			"msg":     constval.GetErrCodeMsg(errCode),
+		}).Infoln("get timetable fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+	appG.Response(httpCode, errCode, map[string]interface{}{"timetable": days})
+}
+
+//@Summary check whether a student meets requirements of a course without booking
+//@Produce json
+//@Param user_id query uint64 false "UserID"
+//@Param course_id query uint64 false "CourseID"
+//@Success 200 {string} json "{"code":200,"data":{eligibility},"msg":{"ok"}}"
+//@Router /api/v1/student/eligibility [get]
+func CheckEligibility(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.CheckEligibilityForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id":   form.UserID,
+			"course_id": form.CourseID,
+		}).Infoln("check eligibility form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	eligibility := models.Eligibility{}
+	httpCode, errCode = form.CheckEligibility(&eligibility)
+	if errCode != constval.OK {
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+	appG.Response(httpCode, errCode, map[string]interface{}{"eligibility": eligibility})
 }
 
+//@Summary courses of a student in the current term with total credits
+//@Produce json
+//@Param user_id query uint64 false "UserID"
+//@Success 200 {string} json "{"code":200,"data":{course_list,total_credits,min_credits,max_credits},"msg":{"ok"}}"
+//@Router /api/v1/student/course [get]
 func GetStudentCourse(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.GetStudentCourseForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("user_id", form.UserID).Infoln("get student course form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	courses := []models.Course{}
+	limit := models.CreditLimit{}
+	httpCode, errCode = form.GetStudentCourse(&courses)
+	if errCode == constval.OK {
+		httpCode, errCode = form.GetCreditLimit(&limit)
+	}
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": form.UserID,
+			"msg":     constval.GetErrCodeMsg(errCode),
+		}).Infoln("get student course fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	var totalCredits uint
+	for _, course := range courses {
+		totalCredits += course.Credits
+	}
+	appG.Response(httpCode, errCode, map[string]interface{}{
+		"course_list":   courses,
+		"total_credits": totalCredits,
+		"min_credits":   limit.MinCredits,
+		"max_credits":   limit.MaxCredits,
+	})
+}
 
+//whether the login user may act for the user, i.e. is the user or an admin. Must be used
+//after middleware.Token
+func actsFor(c *gin.Context, userID string) bool {
+	userInfo := c.MustGet(middleware.UserInfoKey).(*models.UserInfo)
+	return userInfo.UserType == int(models.Admin) || strconv.FormatUint(userInfo.UserID, 10) == userID
 }
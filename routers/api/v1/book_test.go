@@ -0,0 +1,29 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	middleware "github.com/hollowdjj/course-selecting-sys/middleware/token"
+	"github.com/hollowdjj/course-selecting-sys/models"
+)
+
+func TestActsFor(t *testing.T) {
+	cases := []struct {
+		user      models.UserInfo
+		studentID string
+		want      bool
+	}{
+		{models.UserInfo{UserID: 7, UserType: int(models.Student)}, "7", true},
+		{models.UserInfo{UserID: 7, UserType: int(models.Student)}, "8", false},
+		{models.UserInfo{UserID: 1, UserType: int(models.Admin)}, "8", true},
+	}
+	for _, c := range cases {
+		ctx := &gin.Context{}
+		user := c.user
+		ctx.Set(middleware.UserInfoKey, &user)
+		if got := actsFor(ctx, c.studentID); got != c.want {
+			t.Errorf("user %d of type %d acts for %s: want %v, got %v", user.UserID, user.UserType, c.studentID, c.want, got)
+		}
+	}
+}
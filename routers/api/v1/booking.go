@@ -0,0 +1,142 @@
+package v1
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/conf"
+	middleware "github.com/hollowdjj/course-selecting-sys/middleware/token"
+	"github.com/hollowdjj/course-selecting-sys/models"
+	"github.com/hollowdjj/course-selecting-sys/pkg/app"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/event"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/hollowdjj/course-selecting-sys/proxy"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	eventRetry     = 3 * time.Second  //how long a browser waits before reconnecting
+	eventKeepAlive = 15 * time.Second //comments sent to keep an idle stream open through proxies
+)
+
+//@Summary poll the result of an asynchronous booking of the login student
+//@Description tickets are kept on the node which queued the booking, polls reaching other nodes are forwarded to it
+//@Produce json
+//@Param ticket path string true "ticket returned by book_course"
+//@Success 200 {string} json "{"code":200,"data":{ticket},"msg":{"ok"}}"
+//@Router /api/v1/student/booking/{ticket} [get]
+func GetBooking(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form = models.GetTicketForm{Ticket: c.Param("ticket")}
+	)
+
+	//form validation
+	errs, err := app.ValidCustom(&form, nil)
+	if err != nil || len(errs) > 0 {
+		logger.GetInstance().WithField("ticket", form.Ticket).Infoln("get booking form invalid")
+		appG.Response(http.StatusBadRequest, constval.ParamInvalid, nil)
+		return
+	}
+
+	//the ticket is kept on the node which queued the booking
+	if node := models.TicketNode(form.Ticket); node != "" && node != conf.GetApp().Host && !proxy.IsForwarded(c) {
+		proxy.Forward(c, node)
+		return
+	}
+
+	//get ticket
+	ticket := models.Ticket{}
+	httpCode, errCode := form.GetTicket(&ticket)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"ticket": form.Ticket,
+			"msg":    constval.GetErrCodeMsg(errCode),
+		}).Infoln("get booking fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+	if !actsFor(c, ticket.UserID) {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"ticket": form.Ticket,
+			"userid": ticket.UserID,
+		}).Infoln("get booking of another student")
+		appG.Response(http.StatusForbidden, constval.PermDenied, nil)
+		return
+	}
+	appG.Response(httpCode, errCode, ticket)
+}
+
+//@Summary server-sent events of booking results of the login student and seats of watched courses
+//@Description events are relayed across nodes, so the student may connect to any node
+//@Produce text/event-stream
+//@Param course_ids query string false "comma separated course ids to watch"
+//@Success 200 {string} string "event: seats\ndata: {"course_id":1,"remain_cap":10}"
+//@Router /api/v1/student/events [get]
+func WatchEvents(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.WatchForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"course_ids": form.CourseIDs,
+			"msg":        constval.GetErrCodeMsg(errCode),
+		}).Infoln("watch events form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	//subscribe, booking results are those of the login user
+	userInfo := c.MustGet(middleware.UserInfoKey).(*models.UserInfo)
+	var sub *event.Subscriber
+	seats := []models.Seats{}
+	httpCode, errCode = form.Watch(strconv.FormatUint(userInfo.UserID, 10), &sub, &seats)
+	if errCode != constval.OK {
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+	defer event.GetHub().Unsubscribe(sub)
+
+	//the server cuts a response after WriteTimeout, so the stream is ended a little earlier and
+	//the browser reconnects
+	streamTime := time.Duration(conf.GetServer().WriteTimeout)*time.Second - eventRetry
+	if streamTime <= 0 {
+		streamTime = time.Minute
+	}
+	end := time.NewTimer(streamTime)
+	defer end.Stop()
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", eventRetry/time.Millisecond)
+	for _, s := range seats {
+		c.SSEvent(models.EventSeats, s)
+	}
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e := <-sub.C:
+			c.SSEvent(e.Name, e.Data)
+			return true
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-end.C:
+			return false
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
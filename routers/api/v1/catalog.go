@@ -0,0 +1,139 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/models"
+	"github.com/hollowdjj/course-selecting-sys/pkg/app"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+//@Summary create a catalog course, sections are created by /course/create with its catalog_id
+//@Produce json
+//@Param name query string false "Name"
+//@Param code query string false "Code"
+//@Param credits query uint false "Credits"
+//@Param department query string false "Department"
+//@Param description query string false "Description"
+//@Param language query string false "Language of instruction"
+//@Param tags query string false "comma separated tags"
+//@Success 200 {string} json "{"code":200,"data":{catalog_id},"msg":{"ok"}}"
+//@Router /api/v1/catalog/create [post]
+func CreateCatalog(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.CreateCatalogForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"name": form.Name,
+			"code": form.Code,
+			"msg":  constval.GetErrCodeMsg(errCode),
+		}).Infoln("create catalog course form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	catalog := &models.CatalogCourse{}
+	httpCode, errCode = form.CreateCatalog(catalog)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"name": form.Name,
+			"code": form.Code,
+			"msg":  constval.GetErrCodeMsg(errCode),
+		}).Infoln("create catalog course fail")
+		appG.Response(httpCode, errCode, map[string]interface{}{"catalog_id": catalog.CatalogID})
+		return
+	}
+
+	logger.GetInstance().WithFields(logrus.Fields{
+		"name":       form.Name,
+		"catalog_id": catalog.CatalogID,
+	}).Infoln("create catalog course succ")
+	appG.Response(httpCode, errCode, map[string]interface{}{"catalog_id": catalog.CatalogID})
+}
+
+//@Summary sections of a catalog course in a term
+//@Produce json
+//@Param catalog_id query uint64 false "CatalogID"
+//@Param term_id query uint64 false "TermID, default current term"
+//@Success 200 {string} json "{"code":200,"data":{sections},"msg":{"ok"}}"
+//@Router /api/v1/catalog/sections [get]
+func GetSections(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.GetSectionsForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("catalog_id", form.CatalogID).Infoln("get sections form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	sections := []models.Course{}
+	httpCode, errCode = form.GetSections(&sections)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"catalog_id": form.CatalogID,
+			"msg":        constval.GetErrCodeMsg(errCode),
+		}).Infoln("get sections fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+	appG.Response(httpCode, errCode, map[string]interface{}{"sections": sections})
+}
+
+//@Summary browse the catalog
+//@Produce json
+//@Param q query string false "full-text search over name and description"
+//@Param department query string false "Department"
+//@Param language query string false "Language"
+//@Param tag query string false "Tag"
+//@Param cursor query string false "Cursor"
+//@Param limit query int false "Limit"
+//@Success 200 {string} json "{"code":200,"data":{catalog_list,total,next_cursor,prev_cursor},"msg":{"ok"}}"
+//@Router /api/v1/catalog/list [get]
+func GetCatalogList(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.GetCatalogListForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"form": form,
+			"msg":  constval.GetErrCodeMsg(errCode),
+		}).Infoln("get catalog list form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	var (
+		catalogs = []models.CatalogCourse{}
+		total    int64
+		page     models.Page
+	)
+	httpCode, errCode = form.GetCatalogList(&catalogs, &total, &page)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("form", form).Errorln("get catalog list fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	logger.GetInstance().WithField("form", form).Infoln("get catalog list succ")
+	appG.Response(httpCode, errCode, map[string]interface{}{
+		"catalog_list": catalogs,
+		"total":        total,
+		"next_cursor":  page.NextCursor,
+		"prev_cursor":  page.PrevCursor,
+	})
+}
@@ -0,0 +1,133 @@
+package v1
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/models"
+	"github.com/hollowdjj/course-selecting-sys/pkg/app"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+//@Summary rename a course or change its cap
+//@Accept json
+//@Produce json
+//@Param course body models.UpdateCourseForm true "course_id and fields to update"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/course/update [post]
+func UpdateCourse(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.UpdateCourseForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"course_id": form.CourseID,
+			"msg":       constval.GetErrCodeMsg(errCode),
+		}).Infoln("update course form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	//update course
+	httpCode, errCode = form.UpdateCourse(actorOf(c))
+	msg := "update course succ"
+	if errCode != constval.OK {
+		msg = "update course fail"
+	}
+	logger.GetInstance().WithFields(logrus.Fields{
+		"course_id": form.CourseID,
+		"msg":       constval.GetErrCodeMsg(errCode),
+	}).Infoln(msg)
+	appG.Response(httpCode, errCode, nil)
+}
+
+//@Summary delete a course nobody has booked
+//@Accept json
+//@Produce json
+//@Param course_id body uint64 true "CourseID"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/course/delete [post]
+func DeleteCourse(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.DeleteCourseForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"course_id": form.CourseID,
+			"msg":       constval.GetErrCodeMsg(errCode),
+		}).Infoln("delete course form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	//delete course
+	httpCode, errCode = form.DeleteCourse(actorOf(c))
+	msg := "delete course succ"
+	if errCode != constval.OK {
+		msg = "delete course fail"
+	}
+	logger.GetInstance().WithFields(logrus.Fields{
+		"course_id": form.CourseID,
+		"msg":       constval.GetErrCodeMsg(errCode),
+	}).Infoln(msg)
+	appG.Response(httpCode, errCode, nil)
+}
+
+//@Summary list courses of a term
+//@Produce json
+//@Param term_id query uint64 false "TermID, default current term"
+//@Param teacher_id query uint64 false "TeacherID"
+//@Param department query string false "Department of the catalog course"
+//@Param has_seats query bool false "only courses with remain cap"
+//@Param name query string false "part of course name"
+//@Param sort_by query string false "course_id, course_name or remain_cap"
+//@Param order query string false "asc or desc"
+//@Param cursor query string false "Cursor"
+//@Param limit query int false "Limit"
+//@Success 200 {string} json "{"code":200,"data":{course_list,total,next_cursor,prev_cursor},"msg":{"ok"}}"
+//@Router /api/v1/course/list [get]
+func GetCourseList(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.GetCourseListForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"form": form,
+			"msg":  constval.GetErrCodeMsg(errCode),
+		}).Infoln("get course list form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	var (
+		courses = []models.Course{}
+		total   int64
+		page    models.Page
+	)
+	httpCode, errCode = form.GetCourseList(&courses, &total, &page)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("form", form).Errorln("get course list fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	logger.GetInstance().WithField("form", form).Infoln("get course list succ")
+	appG.Response(httpCode, errCode, map[string]interface{}{
+		"course_list": courses,
+		"total":       total,
+		"next_cursor": page.NextCursor,
+		"prev_cursor": page.PrevCursor,
+	})
+}
@@ -0,0 +1,132 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/models"
+	"github.com/hollowdjj/course-selecting-sys/pkg/app"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/export"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+//write export response. Headers are sent before the first row, so an error in the
+//middle of streaming can only be logged and the response is truncated
+func streamExport(c *gin.Context, filename, format string, header []string, fn func(w *export.Writer) error) {
+	c.Header("Content-Disposition", `attachment; filename="`+filename+"."+format+`"`)
+	c.Header("Content-Type", export.ContentType(format))
+	c.Status(http.StatusOK)
+
+	w, err := export.NewWriter(c.Writer, format, header)
+	if err == nil {
+		err = fn(w)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"file": filename,
+			"err":  err,
+		}).Errorln("export error")
+	}
+}
+
+//@Summary	导出成员，过滤条件同/member/list
+//@Produce text/csv,application/x-ndjson
+//@Param format query string true "csv or jsonl"
+//@Success 200 {string} string "user rows"
+//@Router /api/v1/member/export [get]
+func ExportUsers(c *gin.Context) {
+	var (
+		appG       = app.Gin{C: c}
+		form       models.GetUserListForm
+		exportForm models.ExportForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode == constval.OK {
+		httpCode, errCode = app.BindAndValid(c, &exportForm, false)
+	}
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("format", exportForm.Format).Infoln("export users form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	streamExport(c, "members", exportForm.Format, models.UserExportHeader, func(w *export.Writer) error {
+		return form.ExportUsers(func(u models.UserInfo) error {
+			return w.Write(u)
+		})
+	})
+}
+
+//@Summary	导出课程已选学生名单
+//@Produce text/csv,application/x-ndjson
+//@Param course_id query uint64 true "CourseID"
+//@Param format query string true "csv or jsonl"
+//@Success 200 {string} string "student rows"
+//@Router /api/v1/course/export_students [get]
+func ExportCourseStudents(c *gin.Context) {
+	var (
+		appG       = app.Gin{C: c}
+		form       models.ExportCourseStudentsForm
+		exportForm models.ExportForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode == constval.OK {
+		httpCode, errCode = app.BindAndValid(c, &exportForm, false)
+	}
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("course_id", form.CourseID).Infoln("export course students form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	streamExport(c, "course_students", exportForm.Format, models.UserExportHeader, func(w *export.Writer) error {
+		return form.ExportCourseStudents(func(u models.UserInfo) error {
+			return w.Write(u)
+		})
+	})
+}
+
+//@Summary	导出老师的课程
+//@Produce text/csv,application/x-ndjson
+//@Param teacher_id query uint64 true "TeacherID"
+//@Param term_id query uint64 false "TermID, default current term"
+//@Param format query string true "csv or jsonl"
+//@Success 200 {string} string "course rows"
+//@Router /api/v1/teacher/export_course [get]
+func ExportTeacherCourses(c *gin.Context) {
+	var (
+		appG       = app.Gin{C: c}
+		form       models.GetTeacherCourseForm
+		exportForm models.ExportForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode == constval.OK {
+		httpCode, errCode = app.BindAndValid(c, &exportForm, false)
+	}
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("teacher_id", form.TeacherID).Infoln("export teacher courses form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+	if httpCode, errCode = form.ResolveTerm(); errCode != constval.OK {
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	streamExport(c, "teacher_courses", exportForm.Format, models.CourseExportHeader, func(w *export.Writer) error {
+		return form.ExportTeacherCourses(func(course models.Course) error {
+			return w.Write(course)
+		})
+	})
+}
@@ -12,11 +12,20 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-//@Summary creat course
+//@Summary creat course, or a section of a catalog course
 //@Produce json
-//@Param name query string false "Name"
+//@Param name query string false "Name, not used if catalog_id is set"
+//@Param code query string false "Code"
 //@Param cap query uint false "Cap"
-//@Success 200 {string} json "{"code":200,"data":{course_id},"msg":{"ok"}}"
+//@Param credits query uint false "Credits"
+//@Param term_id query uint64 false "TermID, default current term"
+//@Param catalog_id query uint64 false "CatalogID"
+//@Param section query string false "Section"
+//@Param department query string false "Department of the catalog course created without catalog_id"
+//@Param description query string false "Description of the catalog course created without catalog_id"
+//@Param language query string false "Language of the catalog course created without catalog_id"
+//@Param tags query string false "comma separated tags of the catalog course created without catalog_id"
+//@Success 200 {string} json "{"code":200,"data":{course_id,catalog_id},"msg":{"ok"}}"
 //@Router /api/v1/course/create [post]
 func CreateCourse(c *gin.Context) {
 	var (
@@ -37,7 +46,8 @@ func CreateCourse(c *gin.Context) {
 	}
 
 	//creat course
-	course := &models.Course{CourseName: form.Name, Cap: form.Cap, RemainCap: form.Cap}
+	course := &models.Course{CourseName: form.Name, Code: form.Code, Cap: form.Cap, RemainCap: form.Cap,
+		Credits: uint(form.Credits)}
 	httpCode, errCode = form.CreateCourse(course)
 	if errCode != constval.OK {
 		logger.GetInstance().WithFields(logrus.Fields{
@@ -50,10 +60,11 @@ func CreateCourse(c *gin.Context) {
 	}
 
 	logger.GetInstance().WithFields(logrus.Fields{
-		"course_name": form.Name,
+		"course_name": course.CourseName,
+		"section":     course.Section,
 		"cap":         form.Cap,
 	}).Infoln("create course succ")
-	appG.Response(httpCode, errCode, map[string]interface{}{"course_id": course.CourseID})
+	appG.Response(httpCode, errCode, map[string]interface{}{"course_id": course.CourseID, "catalog_id": course.CatalogID})
 }
 
 //@Summary get course info
@@ -91,7 +102,7 @@ func GetCourse(c *gin.Context) {
 	appG.Response(http.StatusOK, constval.OK, map[string]interface{}{"course:": *course})
 }
 
-//@Summary  bind course with teacher
+//@Summary  bind course with teacher. Only the teacher or an admin may bind
 //@Produce json
 //@Param course_id query uint64 false "CourseList"
 //@Param teacher_id query uint64 false "TeacherID"
@@ -114,7 +125,17 @@ func BindCourse(c *gin.Context) {
 		return
 	}
 
-	httpCode, errCode = form.BindCourse()
+	//teachers only bind or unbind themselves
+	if !actsFor(c, form.TeacherID) {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"course_id":  form.CourseID,
+			"teacher_id": form.TeacherID,
+		}).Infoln("bind course for another teacher")
+		appG.Response(http.StatusForbidden, constval.PermDenied, nil)
+		return
+	}
+
+	httpCode, errCode = form.BindCourse(actorOf(c))
 	if errCode != constval.OK {
 		logger.GetInstance().WithFields(logrus.Fields{
 			"course_id":  form.CourseID,
@@ -132,7 +153,7 @@ func BindCourse(c *gin.Context) {
 	appG.Response(httpCode, errCode, nil)
 }
 
-//@Summary unbind course and teacher
+//@Summary unbind course and teacher. Only the teacher or an admin may unbind
 //@Produce json
 //@Param course_id query uint64 false "CourseList"
 //@Param teacher_id query uint64 false "TeacherID"
@@ -156,7 +177,18 @@ func UnBindCourse(c *gin.Context) {
 		return
 	}
 
+	//teachers only bind or unbind themselves
+	if !actsFor(c, form.TeacherID) {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"course_id":  form.CourseID,
+			"teacher_id": form.TeacherID,
+		}).Infoln("unbind course for another teacher")
+		appG.Response(http.StatusForbidden, constval.PermDenied, nil)
+		return
+	}
+
 	//unbind course
+	httpCode, errCode = form.UnBindCourse(actorOf(c))
 	if errCode != constval.OK {
 		logger.GetInstance().WithFields(logrus.Fields{
 			"course_id":  form.CourseID,
@@ -177,7 +209,10 @@ func UnBindCourse(c *gin.Context) {
 //@Summary get all courses of teacher
 //@Produce json
 //@Param teacher_id query uint64 false "TeacherID"
-//@Success 200 {string} json "{"code":200,"data":{courses},"msg":{"ok"}}"
+//@Param term_id query uint64 false "TermID, default current term"
+//@Param cursor query string false "Cursor"
+//@Param limit query int false "Limit"
+//@Success 200 {string} json "{"code":200,"data":{course_list,next_cursor,prev_cursor},"msg":{"ok"}}"
 //@Router /api/v1/teacher/get_course [GET]
 func GetTeacherCourses(c *gin.Context) {
 	var (
@@ -198,7 +233,8 @@ func GetTeacherCourses(c *gin.Context) {
 
 	//get courses
 	courses := &[]models.Course{}
-	httpCode, errCode = form.GetTeacherCourses(courses)
+	page := models.Page{}
+	httpCode, errCode = form.GetTeacherCourses(courses, &page)
 	if errCode != constval.OK {
 		logger.GetInstance().WithFields(logrus.Fields{
 			"teacher_id": form.TeacherID,
@@ -209,7 +245,11 @@ func GetTeacherCourses(c *gin.Context) {
 	}
 
 	logger.GetInstance().WithField("teacher_id", form.TeacherID).Infoln("get teacher course succ")
-	appG.Response(httpCode, errCode, map[string]interface{}{"course_list": courses})
+	appG.Response(httpCode, errCode, map[string]interface{}{
+		"course_list": courses,
+		"next_cursor": page.NextCursor,
+		"prev_cursor": page.PrevCursor,
+	})
 }
 
 func Schedule(c *gin.Context) {
@@ -231,3 +271,70 @@ func Schedule(c *gin.Context) {
 	}
 	appG.Response(http.StatusOK, constval.OK, utility.MaxMatch(data))
 }
+
+//@Summary set weekly meeting slots of a course, admin only. Old slots are replaced
+//@Produce json
+//@Param course_id query uint64 false "CourseID"
+//@Param slots query []object false "Slots of weekday, start_period, end_period, start_week, end_week and location"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/course/slots/set [post]
+func SetCourseSlots(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.SetCourseSlotsForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("course_id", form.CourseID).Infoln("set course slots form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	httpCode, errCode = form.SetCourseSlots(actorOf(c))
+	msg := "set course slots succ"
+	if errCode != constval.OK {
+		msg = "set course slots fail"
+	}
+	logger.GetInstance().WithFields(logrus.Fields{
+		"course_id": form.CourseID,
+		"slots":     len(form.Slots),
+		"msg":       constval.GetErrCodeMsg(errCode),
+	}).Infoln(msg)
+	appG.Response(httpCode, errCode, nil)
+}
+
+//@Summary set eligibility requirements of a course, admin only. Old requirements are replaced
+//@Produce json
+//@Param course_id query uint64 false "CourseID"
+//@Param prerequisites query []string false "Codes of courses which must be completed"
+//@Param min_year query int false "Minimum year of study"
+//@Param departments query []string false "Eligible departments"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/course/requirement/set [post]
+func SetCourseRequirement(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.SetRequirementForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("course_id", form.CourseID).Infoln("set course requirement form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	httpCode, errCode = form.SetRequirement(actorOf(c))
+	msg := "set course requirement succ"
+	if errCode != constval.OK {
+		msg = "set course requirement fail"
+	}
+	logger.GetInstance().WithFields(logrus.Fields{
+		"course_id": form.CourseID,
+		"msg":       constval.GetErrCodeMsg(errCode),
+	}).Infoln(msg)
+	appG.Response(httpCode, errCode, nil)
+}
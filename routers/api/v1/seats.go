@@ -0,0 +1,130 @@
+package v1
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/hollowdjj/course-selecting-sys/models"
+	"github.com/hollowdjj/course-selecting-sys/pkg/app"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/event"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	wsMaxMessage = 4096
+)
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+//a message sent over the seats websocket, in the same shape as app.Response plus the event name
+type seatsMessage struct {
+	Event string         `json:"event"` //subscribe, unsubscribe or seats
+	Code  constval.ErrNo `json:"code"`
+	Msg   string         `json:"msg"`
+	Data  interface{}    `json:"data"`
+}
+
+//@Summary watch remain_cap of courses over a websocket
+//@Description send {"action":"subscribe","course_ids":[1,2]} or {"action":"unsubscribe","course_ids":[1]},
+//@Description the reply carries current seats of subscribed courses, later changes are pushed as seats events
+//@Success 101 {string} json "{"event":"seats","code":0,"msg":"ok","data":{"course_id":1,"remain_cap":10}}"
+//@Router /api/v1/course/seats [get]
+func WatchSeats(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		//the upgrader has replied with an error
+		logger.GetInstance().WithField("err", err).Infoln("upgrade seats websocket fail")
+		return
+	}
+	defer conn.Close()
+
+	var sub *event.Subscriber
+	defer func() {
+		if sub != nil {
+			event.GetHub().Unsubscribe(sub)
+		}
+	}()
+
+	//only this goroutine reads, messages are handed to the loop below which is the only writer
+	messages := make(chan []byte)
+	closed := make(chan struct{})
+	conn.SetReadLimit(wsMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			select {
+			case messages <- data:
+			case <-c.Request.Context().Done():
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	//sub is created by the first subscription, seats events are not received before it
+	var events <-chan event.Event
+	for {
+		var msg seatsMessage
+		select {
+		case data := <-messages:
+			msg = watchSeats(&sub, data)
+			if sub != nil {
+				events = sub.C
+			}
+		case e := <-events:
+			msg = seatsMessage{Event: e.Name, Code: constval.OK, Msg: constval.GetErrCodeMsg(constval.OK), Data: e.Data}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+			continue
+		case <-closed:
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+//apply a subscribe or unsubscribe message and build the reply
+func watchSeats(sub **event.Subscriber, data []byte) seatsMessage {
+	form := models.WatchSeatsForm{}
+	errCode := constval.OK
+	if err := json.Unmarshal(data, &form); err != nil {
+		errCode = constval.ParamInvalid
+	} else if errs, err := app.ValidCustom(&form, nil); err != nil || len(errs) > 0 {
+		errCode = constval.ParamInvalid
+	}
+
+	seats := []models.Seats{}
+	if errCode == constval.OK {
+		_, errCode = form.WatchSeats(sub, &seats)
+	}
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"action":     form.Action,
+			"course_ids": form.CourseIDs,
+			"msg":        constval.GetErrCodeMsg(errCode),
+		}).Infoln("watch seats fail")
+		return seatsMessage{Event: form.Action, Code: errCode, Msg: constval.GetErrCodeMsg(errCode)}
+	}
+	return seatsMessage{Event: form.Action, Code: errCode, Msg: constval.GetErrCodeMsg(errCode), Data: seats}
+}
@@ -0,0 +1,267 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/models"
+	"github.com/hollowdjj/course-selecting-sys/pkg/app"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+//@Summary create a term, admin only
+//@Produce json
+//@Param name query string false "Name"
+//@Param start_date query string false "StartDate, YYYY-MM-DD"
+//@Param end_date query string false "EndDate, YYYY-MM-DD"
+//@Param min_credits query uint false "MinCredits of a student"
+//@Param max_credits query uint false "MaxCredits of a student, 0 means no limit"
+//@Param drop_deadline query int64 false "DropDeadline, unix timestamp"
+//@Success 200 {string} json "{"code":200,"data":{term},"msg":{"ok"}}"
+//@Router /api/v1/term/create [post]
+func CreateTerm(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.CreateTermForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("name", form.Name).Infoln("create term form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	//create term
+	term := models.Term{}
+	httpCode, errCode = form.CreateTerm(&term, actorOf(c))
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"name": form.Name,
+			"msg":  constval.GetErrCodeMsg(errCode),
+		}).Infoln("create term fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	logger.GetInstance().WithFields(logrus.Fields{
+		"term_id": term.TermID,
+		"name":    term.Name,
+	}).Infoln("create term succ")
+	appG.Response(httpCode, errCode, map[string]interface{}{"term": term})
+}
+
+//@Summary open a planned term, which becomes the current term. Admin only
+//@Produce json
+//@Param term_id query uint64 false "TermID"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/term/open [post]
+func OpenTerm(c *gin.Context) {
+	updateTermStatus(c, "open", (*models.TermStatusForm).OpenTerm)
+}
+
+//@Summary archive a term, admin only
+//@Produce json
+//@Param term_id query uint64 false "TermID"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/term/archive [post]
+func ArchiveTerm(c *gin.Context) {
+	updateTermStatus(c, "archive", (*models.TermStatusForm).ArchiveTerm)
+}
+
+func updateTermStatus(c *gin.Context, op string, update func(*models.TermStatusForm, models.Actor) (int, constval.ErrNo)) {
+	var (
+		appG = app.Gin{C: c}
+		form models.TermStatusForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("term_id", form.TermID).Infoln(op + " term form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	httpCode, errCode = update(&form, actorOf(c))
+	msg := op + " term succ"
+	if errCode != constval.OK {
+		msg = op + " term fail"
+	}
+	logger.GetInstance().WithFields(logrus.Fields{
+		"term_id": form.TermID,
+		"msg":     constval.GetErrCodeMsg(errCode),
+	}).Infoln(msg)
+	appG.Response(httpCode, errCode, nil)
+}
+
+//@Summary list terms
+//@Produce json
+//@Success 200 {string} json "{"code":200,"data":{term_list},"msg":{"ok"}}"
+//@Router /api/v1/term/list [get]
+func GetTerms(c *gin.Context) {
+	appG := app.Gin{C: c}
+
+	terms := []models.Term{}
+	httpCode, errCode := models.GetTerms(&terms)
+	if errCode != constval.OK {
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+	appG.Response(http.StatusOK, constval.OK, map[string]interface{}{"term_list": terms})
+}
+
+//@Summary get the current term
+//@Produce json
+//@Success 200 {string} json "{"code":200,"data":{term},"msg":{"ok"}}"
+//@Router /api/v1/term/current [get]
+func GetCurrentTerm(c *gin.Context) {
+	appG := app.Gin{C: c}
+
+	term := models.Term{}
+	httpCode, errCode := models.GetCurrentTerm(&term)
+	if errCode != constval.OK {
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+	appG.Response(http.StatusOK, constval.OK, map[string]interface{}{"term": term})
+}
+
+//@Summary create an enrollment phase of a term, admin only
+//@Produce json
+//@Param term_id query uint64 false "TermID, default current term"
+//@Param name query string false "Name"
+//@Param start_at query int64 false "StartAt, unix timestamp"
+//@Param end_at query int64 false "EndAt, unix timestamp"
+//@Param grades query []int false "Eligible years of enrollment"
+//@Param departments query []string false "Eligible departments"
+//@Param max_credits query int false "MaxCredits"
+//@Success 200 {string} json "{"code":200,"data":{phase},"msg":{"ok"}}"
+//@Router /api/v1/term/phase/create [post]
+func CreatePhase(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.CreatePhaseForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("name", form.Name).Infoln("create enrollment phase form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	phase := models.EnrollmentPhase{}
+	httpCode, errCode = form.CreatePhase(&phase, actorOf(c))
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"name": form.Name,
+			"msg":  constval.GetErrCodeMsg(errCode),
+		}).Infoln("create enrollment phase fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	logger.GetInstance().WithFields(logrus.Fields{
+		"phase_id": phase.PhaseID,
+		"term_id":  phase.TermID,
+	}).Infoln("create enrollment phase succ")
+	appG.Response(httpCode, errCode, map[string]interface{}{"phase": phase})
+}
+
+//@Summary delete an enrollment phase, admin only
+//@Produce json
+//@Param phase_id query uint64 false "PhaseID"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/term/phase/delete [post]
+func DeletePhase(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.DeletePhaseForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("phase_id", form.PhaseID).Infoln("delete enrollment phase form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	httpCode, errCode = form.DeletePhase(actorOf(c))
+	msg := "delete enrollment phase succ"
+	if errCode != constval.OK {
+		msg = "delete enrollment phase fail"
+	}
+	logger.GetInstance().WithFields(logrus.Fields{
+		"phase_id": form.PhaseID,
+		"msg":      constval.GetErrCodeMsg(errCode),
+	}).Infoln(msg)
+	appG.Response(httpCode, errCode, nil)
+}
+
+//@Summary list enrollment phases of a term
+//@Produce json
+//@Param term_id query uint64 false "TermID, default current term"
+//@Success 200 {string} json "{"code":200,"data":{phase_list},"msg":{"ok"}}"
+//@Router /api/v1/term/phase/list [get]
+func GetPhases(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.GetPhasesForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode != constval.OK {
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	phases := []models.EnrollmentPhase{}
+	httpCode, errCode = form.GetPhases(&phases)
+	if errCode != constval.OK {
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+	appG.Response(http.StatusOK, constval.OK, map[string]interface{}{"phase_list": phases})
+}
+
+//@Summary override the credit load of a student in a term, admin only
+//@Produce json
+//@Param user_id query uint64 false "UserID"
+//@Param term_id query uint64 false "TermID, default current term"
+//@Param min_credits query uint false "MinCredits"
+//@Param max_credits query uint false "MaxCredits, 0 means no limit"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/term/credit_limit/set [post]
+func SetCreditLimit(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.SetCreditLimitForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("user_id", form.UserID).Infoln("set credit limit form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	httpCode, errCode = form.SetCreditLimit(actorOf(c))
+	msg := "set credit limit succ"
+	if errCode != constval.OK {
+		msg = "set credit limit fail"
+	}
+	logger.GetInstance().WithFields(logrus.Fields{
+		"user_id": form.UserID,
+		"term_id": form.TermID,
+		"msg":     constval.GetErrCodeMsg(errCode),
+	}).Infoln(msg)
+	appG.Response(httpCode, errCode, nil)
+}
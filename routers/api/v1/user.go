@@ -1,9 +1,11 @@
 package v1
 
 import (
+	"encoding/csv"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	middleware "github.com/hollowdjj/course-selecting-sys/middleware/token"
 	"github.com/hollowdjj/course-selecting-sys/models"
 	"github.com/hollowdjj/course-selecting-sys/pkg/app"
 	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
@@ -12,6 +14,8 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const maxImportFileBytes = 10 << 20
+
 //@Summary create member
 //@Produce json
 //@Param username query string false "UserName"
@@ -25,21 +29,12 @@ func CreateUser(c *gin.Context) {
 		appG = app.Gin{C: c}
 		form models.CreateUserForm
 	)
-	c.
-	//check if user is admin
-	token := c.GetHeader("Authorization")
-	httpCode, errCode := models.IsAdmin(token)
-	if errCode != constval.OK {
-		logger.GetInstance().Errorln("user is not admin")
-		appG.Response(httpCode, errCode, nil)
-		return
-	}
 
-	//form validation
+	//form validation, admin permission is checked by middleware
 	funcs := app.CustomFunc{
 		"PasswordCheck": utility.PasswordCheck,
 	}
-	httpCode, errCode = app.BindAndValidCustom(c, &form, funcs, true)
+	httpCode, errCode := app.BindAndValidCustom(c, &form, funcs, true)
 	if errCode != constval.OK {
 		logger.GetInstance().WithFields(logrus.Fields{
 			"username": form.Username,
@@ -58,7 +53,7 @@ func CreateUser(c *gin.Context) {
 		UserType: form.UserType,
 		Nickname: form.Nickname,
 	}
-	httpCode, errCode = form.CreateUser(user)
+	httpCode, errCode = form.CreateUser(user, actorOf(c))
 	appG.Response(httpCode, errCode, map[string]interface{}{"user_id:": user.UserID})
 	logger.GetInstance().WithFields(logrus.Fields{
 		"username": form.Username,
@@ -67,10 +62,15 @@ func CreateUser(c *gin.Context) {
 	}).Infoln("create user succ")
 }
 
-//@Summary update user's nickname
+//@Summary update member's nickname and profile
 //@Produce json
 //@Param user_id query uint false "UserID"
 //@Param nickname query string false "Nickname"
+//@Param number query string false "Student or staff number, admin only"
+//@Param department query string false "Department, admin only"
+//@Param grade query int false "Year of enrollment, admin only"
+//@Param email query string false "Email"
+//@Param phone query string false "Phone"
 //@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
 //@Router	/api/v1/member/update [post]
 func UpdateUser(c *gin.Context) {
@@ -78,30 +78,28 @@ func UpdateUser(c *gin.Context) {
 		appG = app.Gin{C: c}
 		form models.UpdateMemberForm
 	)
+	operator := c.MustGet(middleware.UserInfoKey).(*models.UserInfo)
 
 	//form validation
 	httpCode, errCode := app.BindAndValid(c, &form, true)
 	if errCode != constval.OK {
-		logger.GetInstance().WithFields(logrus.Fields{
-			"user_id":   form.UserID,
-			"nick_name": form.Nickname,
-		}).Infoln("update user request form incorrect")
+		logger.GetInstance().WithField("user_id", form.UserID).Infoln("update user request form incorrect")
 		appG.Response(httpCode, errCode, nil)
 		return
 	}
-	
+
 	//update user
-	httpCode, errCode = form.UpdateUser()
+	httpCode, errCode = form.UpdateUser(operator, actorOf(c))
 	msg := ""
 	if errCode == constval.OK {
-		msg = "update user nickname succ"
+		msg = "update user succ"
 	} else {
-		msg = "update user nickname fail"
+		msg = "update user fail"
 	}
 	logger.GetInstance().WithFields(logrus.Fields{
-		"user_id":   form.UserID,
-		"nick_name": form.Nickname,
-	}).Errorln(msg)
+		"user_id":  form.UserID,
+		"operator": operator.UserID,
+	}).Infoln(msg)
 
 	appG.Response(httpCode, errCode, nil)
 }
@@ -126,7 +124,7 @@ func DeleteUser(c *gin.Context) {
 	}
 
 	//delete user
-	httpCode, errCode = form.DeleteUser()
+	httpCode, errCode = form.DeleteUser(actorOf(c))
 	appG.Response(httpCode, errCode, nil)
 	msg := ""
 	if errCode == constval.OK {
@@ -137,9 +135,41 @@ func DeleteUser(c *gin.Context) {
 	logger.GetInstance().WithField("user_id", form.UserID).Infoln(msg)
 }
 
-//@Summary	获取单个成员信息
+//@Summary  恢复已删除的用户
+//@Produce json
+//@Param user_id query uint false "UserID"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/member/restore [post]
+func RestoreUser(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.RestoreUserForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("user_id", form.UserID).Infoln("restore user form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	//restore user
+	httpCode, errCode = form.RestoreUser(actorOf(c))
+	appG.Response(httpCode, errCode, nil)
+	msg := ""
+	if errCode == constval.OK {
+		msg = "restore user succ"
+	} else {
+		msg = "restore user fail"
+	}
+	logger.GetInstance().WithField("user_id", form.UserID).Infoln(msg)
+}
+
+//@Summary	获取单个成员信息，联系方式等资料仅本人和管理员可见
 //@Produce json
 //@Param user_id query uint false "UserID"
+//@Param include_inactive query bool false "IncludeInactive, admin only"
 //@Success 200 {string} json "{"code":200,"data":{userinfo},"msg":{"ok"}}"
 //@Router	/api/v1/member/ [get]
 func GetUser(c *gin.Context) {
@@ -147,6 +177,7 @@ func GetUser(c *gin.Context) {
 		appG = app.Gin{C: c}
 		form models.DelOrGetUserForm
 	)
+	viewer := c.MustGet(middleware.UserInfoKey).(*models.UserInfo)
 
 	//form validation
 	httpCode, errCode := app.BindAndValid(c, &form, false)
@@ -158,7 +189,7 @@ func GetUser(c *gin.Context) {
 
 	//get user info
 	var userInfo models.UserInfo
-	httpCode, errCode = form.GetUserInfo(&userInfo)
+	httpCode, errCode = form.GetMember(viewer, &userInfo)
 	msg := ""
 	if errCode == constval.OK {
 		msg = "get user info succ"
@@ -172,8 +203,16 @@ func GetUser(c *gin.Context) {
 //@Summary	批量获取成员信息
 //@Produce json
 //@Param offset query uint false "OffSet"
-//@Param limit query uint false "Limit"
-//@Success 200 {string} json "{"code":200,"data":{userinfo},"msg":{"ok"}}"
+//@Param limit query uint false "Limit, 0 or larger than MaxPageSize means MaxPageSize. -1 is no longer accepted"
+//@Param cursor query string false "Cursor"
+//@Param user_type query int false "UserType"
+//@Param is_active query int false "IsActive, 0 is admin only"
+//@Param include_inactive query bool false "IncludeInactive, admin only"
+//@Param username query string false "Username prefix"
+//@Param nickname query string false "Nickname prefix"
+//@Param sort_by query string false "SortBy"
+//@Param order query string false "Order"
+//@Success 200 {string} json "{"code":200,"data":{user_list,total,next_cursor,prev_cursor},"msg":{"ok"}}"
 //@Router /api/v1/member/list [get]
 func GetUsers(c *gin.Context) {
 	var (
@@ -182,33 +221,116 @@ func GetUsers(c *gin.Context) {
 	)
 
 	//form validation
-	offset, b1 := c.GetQuery("offset")
-	limit, b2 := c.GetQuery("limit")
-	if !b1 || !b2 {
-		logger.GetInstance().WithFields(logrus.Fields{
-			"offset": offset,
-			"limit":  limit,
-		}).Infoln("get user list form invalid")
-		appG.Response(http.StatusBadGateway, constval.ParamInvalid, nil)
-		return
-	}
 	httpCode, errCode := app.BindAndValid(c, &form, false)
 	if errCode != constval.OK {
 		logger.GetInstance().WithFields(logrus.Fields{
-			"offset": offset,
-			"limit":  limit,
+			"offset": form.Offset,
+			"limit":  form.Limit,
+			"cursor": form.Cursor,
 		}).Infoln("get users form invalid")
 		appG.Response(httpCode, errCode, nil)
 		return
 	}
 
 	//get user list
-	userList := make([]models.UserInfo, form.Limit)
-	httpCode, errCode = form.GetUserList(&userList)
+	var (
+		userList []models.UserInfo
+		total    int64
+		page     models.Page
+	)
+	viewer := c.MustGet(middleware.UserInfoKey).(*models.UserInfo)
+	httpCode, errCode = form.GetUserList(viewer, &userList, &total, &page)
 	if errCode != constval.OK {
-		logger.GetInstance().Errorln("get user list fail")
+		logger.GetInstance().WithField("form", form).Infoln("get user list fail")
+		appG.Response(httpCode, errCode, nil)
+		return
 	}
 
-	logger.GetInstance().Errorln("get user list succ")
-	appG.Response(http.StatusOK, constval.OK, map[string]interface{}{"user_list": userList})
+	logger.GetInstance().WithField("form", form).Infoln("get user list succ")
+	appG.Response(http.StatusOK, constval.OK, map[string]interface{}{
+		"user_list":   userList,
+		"total":       total,
+		"next_cursor": page.NextCursor,
+		"prev_cursor": page.PrevCursor,
+	})
+}
+
+//@Summary	从CSV批量导入成员
+//@Accept multipart/form-data
+//@Produce json,text/csv
+//@Param file formData file true "CSV file with columns username,password,nickname,user_type"
+//@Param dry_run query bool false "DryRun"
+//@Param format query string false "Report format, json or csv"
+//@Success 200 {string} json "{"code":200,"data":{result_list,succeeded,failed},"msg":{"ok"}}"
+//@Router /api/v1/member/import [post]
+func ImportUsers(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.ImportUsersForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("format", form.Format).Infoln("import users form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileBytes)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		logger.GetInstance().WithField("err", err).Infoln("import users file invalid")
+		appG.Response(http.StatusBadRequest, constval.ImportFileInvalid, nil)
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		logger.GetInstance().WithField("err", err).Errorln("open import file error")
+		appG.Response(http.StatusInternalServerError, constval.UnknownError, nil)
+		return
+	}
+	defer file.Close()
+
+	//import users
+	results := []models.ImportResult{}
+	httpCode, errCode = form.ImportUsers(file, actorOf(c), &results)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"file": fileHeader.Filename,
+			"msg":  constval.GetErrCodeMsg(errCode),
+		}).Infoln("import users fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Status == models.ImportFailed {
+			failed++
+		}
+	}
+	logger.GetInstance().WithFields(logrus.Fields{
+		"file":    fileHeader.Filename,
+		"dry_run": form.DryRun,
+		"rows":    len(results),
+		"failed":  failed,
+	}).Infoln("import users succ")
+
+	//per-row report
+	if form.Format == "csv" {
+		c.Header("Content-Disposition", `attachment; filename="import_report.csv"`)
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		w.Write(models.ImportReportHeader)
+		for _, r := range results {
+			w.Write(r.CsvRecord())
+		}
+		w.Flush()
+		return
+	}
+	appG.Response(httpCode, errCode, map[string]interface{}{
+		"result_list": results,
+		"succeeded":   len(results) - failed,
+		"failed":      failed,
+	})
 }
@@ -0,0 +1,200 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/models"
+	"github.com/hollowdjj/course-selecting-sys/pkg/app"
+	"github.com/hollowdjj/course-selecting-sys/pkg/constval"
+	"github.com/hollowdjj/course-selecting-sys/pkg/logger"
+	"github.com/sirupsen/logrus"
+)
+
+//@Summary join the waitlist of a full course. Only the student or an admin may join
+//@Produce json
+//@Param UserID query string false "UserID"
+//@Param CourseID query string false "CourseID"
+//@Success 200 {string} json "{"code":200,"data":{waitlist entry},"msg":{"ok"}}"
+//@Router /api/v1/student/waitlist/join [post]
+func JoinWaitlist(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.WaitlistForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid":   form.UserID,
+			"courseid": form.CourseID,
+			"msg":      constval.GetErrCodeMsg(errCode),
+		}).Infoln("join waitlist form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	if !actsFor(c, form.UserID) {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid":   form.UserID,
+			"courseid": form.CourseID,
+		}).Infoln("join waitlist for another student")
+		appG.Response(http.StatusForbidden, constval.PermDenied, nil)
+		return
+	}
+
+	//join waitlist
+	entry := models.Waitlist{}
+	result := models.BookResult{}
+	httpCode, errCode = form.JoinWaitlist(actorOf(c), &entry, &result)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid":   form.UserID,
+			"courseid": form.CourseID,
+			"msg":      constval.GetErrCodeMsg(errCode),
+		}).Infoln("join waitlist fail")
+		appG.Response(httpCode, errCode, result)
+		return
+	}
+
+	logger.GetInstance().WithFields(logrus.Fields{
+		"userid":   form.UserID,
+		"courseid": form.CourseID,
+		"position": entry.Position,
+	}).Infoln("join waitlist succ")
+	appG.Response(httpCode, errCode, entry)
+}
+
+//@Summary leave the waitlist of a course, a seat held for the student is passed on. Only the student or an admin may leave
+//@Produce json
+//@Param UserID query string false "UserID"
+//@Param CourseID query string false "CourseID"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/student/waitlist/leave [post]
+func LeaveWaitlist(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.WaitlistForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid":   form.UserID,
+			"courseid": form.CourseID,
+			"msg":      constval.GetErrCodeMsg(errCode),
+		}).Infoln("leave waitlist form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	if !actsFor(c, form.UserID) {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid":   form.UserID,
+			"courseid": form.CourseID,
+		}).Infoln("leave waitlist for another student")
+		appG.Response(http.StatusForbidden, constval.PermDenied, nil)
+		return
+	}
+
+	//leave waitlist
+	httpCode, errCode = form.LeaveWaitlist(actorOf(c))
+	msg := "leave waitlist succ"
+	if errCode != constval.OK {
+		msg = "leave waitlist fail"
+	}
+	logger.GetInstance().WithFields(logrus.Fields{
+		"userid":   form.UserID,
+		"courseid": form.CourseID,
+		"msg":      constval.GetErrCodeMsg(errCode),
+	}).Infoln(msg)
+	appG.Response(httpCode, errCode, nil)
+}
+
+//@Summary claim the seat held for a promoted student. Only the student or an admin may claim
+//@Description if the student can no longer take the seat, the promotion ends and the seat is held for the next student
+//@Produce json
+//@Param UserID query string false "UserID"
+//@Param CourseID query string false "CourseID"
+//@Success 200 {string} json "{"code":200,"data":{},"msg":{"ok"}}"
+//@Router /api/v1/student/waitlist/claim [post]
+func ClaimWaitlist(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.WaitlistForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, true)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid":   form.UserID,
+			"courseid": form.CourseID,
+			"msg":      constval.GetErrCodeMsg(errCode),
+		}).Infoln("claim waitlist form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	if !actsFor(c, form.UserID) {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid":   form.UserID,
+			"courseid": form.CourseID,
+		}).Infoln("claim waitlist for another student")
+		appG.Response(http.StatusForbidden, constval.PermDenied, nil)
+		return
+	}
+
+	//claim the held seat
+	result := models.BookResult{}
+	httpCode, errCode = form.ClaimWaitlist(actorOf(c), &result)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"userid":   form.UserID,
+			"courseid": form.CourseID,
+			"msg":      constval.GetErrCodeMsg(errCode),
+		}).Infoln("claim waitlist fail")
+		appG.Response(httpCode, errCode, result)
+		return
+	}
+
+	logger.GetInstance().WithFields(logrus.Fields{
+		"userid":   form.UserID,
+		"courseid": form.CourseID,
+	}).Infoln("claim waitlist succ")
+	appG.Response(httpCode, errCode, nil)
+}
+
+//@Summary waiting and promoted waitlist entries of a student
+//@Produce json
+//@Param user_id query uint64 false "UserID"
+//@Success 200 {string} json "{"code":200,"data":{waitlist},"msg":{"ok"}}"
+//@Router /api/v1/student/waitlist [get]
+func GetWaitlist(c *gin.Context) {
+	var (
+		appG = app.Gin{C: c}
+		form models.GetWaitlistForm
+	)
+
+	//form validation
+	httpCode, errCode := app.BindAndValid(c, &form, false)
+	if errCode != constval.OK {
+		logger.GetInstance().WithField("user_id", form.UserID).Infoln("get waitlist form invalid")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+
+	entries := []models.Waitlist{}
+	httpCode, errCode = form.GetWaitlist(&entries)
+	if errCode != constval.OK {
+		logger.GetInstance().WithFields(logrus.Fields{
+			"user_id": form.UserID,
+			"msg":     constval.GetErrCodeMsg(errCode),
+		}).Infoln("get waitlist fail")
+		appG.Response(httpCode, errCode, nil)
+		return
+	}
+	appG.Response(httpCode, errCode, map[string]interface{}{"waitlist": entries})
+}
@@ -2,42 +2,105 @@ package routers
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/middleware/requestid"
+	middleware "github.com/hollowdjj/course-selecting-sys/middleware/token"
+	"github.com/hollowdjj/course-selecting-sys/proxy"
 	v1 "github.com/hollowdjj/course-selecting-sys/routers/api/v1"
 )
 
 func RegisterRouter() *gin.Engine {
 	//新建一个gin路由并绑定中间件
 	g := gin.New()
-	g.Use(gin.Logger(), gin.Recovery())
+	g.Use(gin.Logger(), gin.Recovery(), requestid.RequestID)
 
 	//设置路由
 	apiv1 := g.Group("/api/v1")
 	{
 		//switch work mode
 		apiv1.POST("/proxy/switch")
+		//events relayed by other nodes
+		apiv1.POST("/proxy/events", proxy.ReceiveEvents)
 
 		apiv1.POST("/auth/login", v1.Login)   //登录
 		apiv1.POST("/auth/logout", v1.Logout) //登出
 		apiv1.GET("/auth/whoami", v1.WhoAmI)  //获取个人信息
 
+		//会话管理
+		session := apiv1.Group("/auth/sessions", middleware.Token)
+		{
+			session.GET("", v1.GetSessions)                                     //列出当前用户的会话
+			session.POST("/revoke", v1.RevokeSession)                           //注销当前用户的某个会话
+			session.POST("/revoke_all", middleware.Admin, v1.RevokeAllSessions) //管理员强制注销某用户的全部会话
+		}
+
+		//密码
+		apiv1.POST("/auth/password/change", middleware.Token, v1.ChangePassword)                            //修改密码
+		apiv1.POST("/auth/password/reset_token", middleware.Token, middleware.Admin, v1.IssuePasswordReset) //管理员签发重置令牌
+		apiv1.POST("/auth/password/reset", v1.ResetPassword)                                                //使用重置令牌重置密码
+
+		//API Key，供批处理脚本等机器调用
+		apiKey := apiv1.Group("/auth/api_keys", middleware.Token, middleware.Admin)
+		{
+			apiKey.GET("", v1.GetApiKeys)
+			apiKey.POST("/create", v1.CreateApiKey)
+			apiKey.POST("/revoke", v1.RevokeApiKey)
+		}
+
 		//成员
-		apiv1.POST("/member/create", v1.CreateUser)
-		apiv1.GET("/member/", v1.GetUser)
-		apiv1.GET("/member/list", v1.GetUsers)
-		apiv1.POST("/member/update", v1.UpdateUser)
-		apiv1.POST("/member/delete", v1.DeleteUser)
+		apiv1.POST("/member/create", middleware.Scope("member:create"), middleware.Token, middleware.Admin, v1.CreateUser)
+		apiv1.GET("/member/", middleware.Token, v1.GetUser)
+		apiv1.GET("/member/list", middleware.Token, v1.GetUsers)
+		apiv1.POST("/member/update", middleware.Token, v1.UpdateUser)
+		apiv1.POST("/member/delete", middleware.Token, middleware.Admin, v1.DeleteUser)
+		apiv1.POST("/member/restore", middleware.Token, middleware.Admin, v1.RestoreUser)
+		apiv1.POST("/member/import", middleware.Scope("member:create"), middleware.Token, middleware.Admin, v1.ImportUsers)
+		apiv1.GET("/member/export", middleware.Token, middleware.Admin, v1.ExportUsers)
+
+		//审计日志
+		apiv1.GET("/audit/list", middleware.Token, middleware.Admin, v1.GetAuditLogs)
+
+		//学期
+		apiv1.POST("/term/create", middleware.Token, middleware.Admin, v1.CreateTerm)
+		apiv1.POST("/term/open", middleware.Token, middleware.Admin, v1.OpenTerm)       //开放学期，成为当前学期
+		apiv1.POST("/term/archive", middleware.Token, middleware.Admin, v1.ArchiveTerm) //归档学期
+		apiv1.GET("/term/list", v1.GetTerms)
+		apiv1.GET("/term/current", v1.GetCurrentTerm)
+		apiv1.POST("/term/phase/create", middleware.Token, middleware.Admin, v1.CreatePhase) //按年级、院系设置选课时间段
+		apiv1.POST("/term/phase/delete", middleware.Token, middleware.Admin, v1.DeletePhase)
+		apiv1.GET("/term/phase/list", v1.GetPhases)
+		apiv1.POST("/term/credit_limit/set", middleware.Token, middleware.Admin, v1.SetCreditLimit) //单独调整某学生的学分上下限
 
 		//排课
-		apiv1.POST("/course/create", v1.CreateCourse)
+		apiv1.POST("/course/create", middleware.Scope("course:create"), middleware.Token, middleware.Admin, v1.CreateCourse)
 		apiv1.GET("/course/get", v1.GetCourse)
-		apiv1.POST("/teacher/bind_course", v1.BindCourse)
-		apiv1.POST("/teacher/unbind_course", v1.UnBindCourse)
+		apiv1.POST("/course/update", middleware.Token, middleware.Admin, v1.UpdateCourse) //修改课程名称、容量
+		apiv1.POST("/course/delete", middleware.Token, middleware.Admin, v1.DeleteCourse)
+		apiv1.GET("/course/list", v1.GetCourseList)
+		apiv1.GET("/course/seats", v1.WatchSeats)                                           //websocket，推送关注课程的余量变化
+		apiv1.POST("/catalog/create", middleware.Token, middleware.Admin, v1.CreateCatalog) //目录课程
+		apiv1.GET("/catalog/sections", v1.GetSections)                                      //目录课程的教学班
+		apiv1.GET("/catalog/list", v1.GetCatalogList)                                       //课程目录检索
+		apiv1.POST("/teacher/bind_course", middleware.Token, v1.BindCourse)                 //教师本人或管理员
+		apiv1.POST("/teacher/unbind_course", middleware.Token, v1.UnBindCourse)
 		apiv1.GET("/teacher/get_course", v1.GetTeacherCourses)
+		apiv1.GET("/course/export_students", middleware.Token, middleware.Admin, v1.ExportCourseStudents)
+		apiv1.GET("/teacher/export_course", middleware.Token, middleware.Admin, v1.ExportTeacherCourses)
 		apiv1.POST("/course/schedule", v1.Schedule)
+		apiv1.POST("/course/slots/set", middleware.Token, middleware.Admin, v1.SetCourseSlots)             //设置课程上课时间地点
+		apiv1.POST("/course/requirement/set", middleware.Token, middleware.Admin, v1.SetCourseRequirement) //设置先修课程等选课条件
 
 		//抢课
-		apiv1.POST("/student/book_course", v1.BookCourse)
+		apiv1.POST("/student/book_course", middleware.Token, v1.BookCourse)
+		apiv1.POST("/student/drop_course", middleware.Token, v1.DropCourse) //退课，仅本人或管理员
 		apiv1.GET("/student/course", v1.GetStudentCourse)
+		apiv1.GET("/student/timetable", v1.GetTimetable)                        //课表
+		apiv1.GET("/student/eligibility", v1.CheckEligibility)                  //检查是否满足选课条件
+		apiv1.POST("/student/waitlist/join", middleware.Token, v1.JoinWaitlist) //候补
+		apiv1.POST("/student/waitlist/leave", middleware.Token, v1.LeaveWaitlist)
+		apiv1.POST("/student/waitlist/claim", middleware.Token, v1.ClaimWaitlist) //候补成功后确认选课
+		apiv1.GET("/student/waitlist", v1.GetWaitlist)
+		apiv1.GET("/student/booking/:ticket", middleware.Token, v1.GetBooking) //查询排队选课的结果
+		apiv1.GET("/student/events", middleware.Token, v1.WatchEvents)         //推送选课结果和关注课程的余量
 	}
 
 	return g
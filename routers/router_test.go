@@ -0,0 +1,70 @@
+package routers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hollowdjj/course-selecting-sys/models"
+)
+
+//api keys are refused by routes which do not declare a scope, before the key is looked up
+func TestApiKeyRefusedWithoutScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := RegisterRouter()
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/api/v1/auth/api_keys/create"},
+		{http.MethodGet, "/api/v1/auth/api_keys"},
+		{http.MethodPost, "/api/v1/auth/password/reset_token"},
+		{http.MethodPost, "/api/v1/member/restore"},
+		{http.MethodGet, "/api/v1/member/export"},
+		{http.MethodPost, "/api/v1/member/update"},
+		{http.MethodGet, "/api/v1/audit/list"},
+		{http.MethodPost, "/api/v1/term/create"},
+		{http.MethodPost, "/api/v1/course/update"},
+		{http.MethodPost, "/api/v1/course/delete"},
+	}
+	for _, r := range routes {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(r.method, r.path, nil)
+		req.Header.Set("Authorization", models.ApiKeyScheme+"csk_member_create")
+		g.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: want %d, got %d", r.method, r.path, http.StatusForbidden, w.Code)
+		}
+	}
+}
+
+//routes which expose data of a member or act for a student require login
+func TestLoginRequired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := RegisterRouter()
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/api/v1/member/?user_id=1"},
+		{http.MethodGet, "/api/v1/member/list"},
+		{http.MethodPost, "/api/v1/member/delete"},
+		{http.MethodPost, "/api/v1/teacher/bind_course"},
+		{http.MethodPost, "/api/v1/teacher/unbind_course"},
+		{http.MethodPost, "/api/v1/student/book_course"},
+		{http.MethodPost, "/api/v1/student/drop_course"},
+		{http.MethodPost, "/api/v1/student/waitlist/join"},
+		{http.MethodPost, "/api/v1/student/waitlist/leave"},
+		{http.MethodPost, "/api/v1/student/waitlist/claim"},
+		{http.MethodGet, "/api/v1/student/booking/abc"},
+		{http.MethodGet, "/api/v1/student/events"},
+	}
+	for _, r := range routes {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest(r.method, r.path, nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s: want %d, got %d", r.method, r.path, http.StatusUnauthorized, w.Code)
+		}
+	}
+}